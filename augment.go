@@ -0,0 +1,451 @@
+package btree
+
+import (
+	"iter"
+	"slices"
+)
+
+// Monoid describes how to summarize the elements of an augmented
+// tree. Measure maps a single element to a summary and Combine
+// merges two adjacent summaries. Combine must be associative and
+// Identity must be its neutral element.
+type Monoid[T, M any] interface {
+	Identity() M
+	Measure(elem T) M
+	Combine(a, b M) M
+}
+
+// AugBTree is a persistent B+Tree that caches a summary of every
+// node using a Monoid. This allows summaries of arbitrary key ranges
+// to be computed in O(log n).
+type AugBTree[T, M any] struct {
+	impl   *BTree[T]
+	monoid Monoid[T, M]
+	sums   *sumNode[T, M]
+}
+
+func EmptyAugmented[T, M any](
+	cmp func(a, b T) int,
+	eq func(a, b T) bool,
+	monoid Monoid[T, M],
+) *AugBTree[T, M] {
+	impl := Empty(cmp, eq)
+	return &AugBTree[T, M]{
+		impl:   impl,
+		monoid: monoid,
+		sums:   updateSums(nil, impl.root, nil, monoid),
+	}
+}
+
+func (t *AugBTree[T, M]) Contains(key T) bool {
+	return t.impl.Contains(key)
+}
+
+func (t *AugBTree[T, M]) At(key T) T {
+	return t.impl.At(key)
+}
+
+func (t *AugBTree[T, M]) Find(key T) (T, bool) {
+	return t.impl.Find(key)
+}
+
+func (t *AugBTree[T, M]) Add(key T) *AugBTree[T, M] {
+	nimpl := t.impl.Add(key)
+	if nimpl == t.impl {
+		return t
+	}
+	return &AugBTree[T, M]{
+		impl:   nimpl,
+		monoid: t.monoid,
+		sums:   updateSums(t.sums, nimpl.root, nil, t.monoid),
+	}
+}
+
+func (t *AugBTree[T, M]) Delete(key T) *AugBTree[T, M] {
+	nimpl := t.impl.Delete(key)
+	if nimpl == t.impl {
+		return t
+	}
+	return &AugBTree[T, M]{
+		impl:   nimpl,
+		monoid: t.monoid,
+		sums:   updateSums(t.sums, nimpl.root, nil, t.monoid),
+	}
+}
+
+func (t *AugBTree[T, M]) Length() int {
+	return t.impl.Length()
+}
+
+func (t *AugBTree[T, M]) String() string {
+	return t.impl.String()
+}
+
+// Comparator returns the function used to order the elements of
+// the tree.
+func (t *AugBTree[T, M]) Comparator() func(a, b T) int {
+	return t.impl.cmp
+}
+
+// WithObserver returns a tree holding the same elements as t that
+// reports the work done by its edits to obs. See BTree.WithObserver.
+func (t *AugBTree[T, M]) WithObserver(obs Observer) *AugBTree[T, M] {
+	return &AugBTree[T, M]{
+		impl:   t.impl.WithObserver(obs),
+		monoid: t.monoid,
+		sums:   t.sums,
+	}
+}
+
+// Iterator returns a stack allocated iterator. One may range over
+// this using (Iterator[T]).Seq().
+func (t *AugBTree[T, M]) Iterator() Iterator[T] {
+	return t.impl.Iterator()
+}
+
+// All allows one to range over the tree.
+func (t *AugBTree[T, M]) All() iter.Seq[T] {
+	return t.impl.All()
+}
+
+// IteratorFrom allows one to start iterating with the first element
+// greater than or equal to "from".
+func (t *AugBTree[T, M]) IteratorFrom(from T) Iterator[T] {
+	return t.impl.IteratorFrom(from)
+}
+
+// From allows one to range over the tree starting with the first
+// element greater than or equal to "from".
+func (t *AugBTree[T, M]) From(from T) iter.Seq[T] {
+	return t.impl.From(from)
+}
+
+// Summary returns the summary of every element in the tree.
+func (t *AugBTree[T, M]) Summary() M {
+	return t.sums.sum
+}
+
+// Aggregate returns the combined summary of the elements between lo
+// and hi inclusive.
+func (t *AugBTree[T, M]) Aggregate(lo, hi T) M {
+	return t.sums.aggregate(lo, hi, false, false, t.impl.cmp, t.monoid)
+}
+
+// Select allows one to range over the elements whose measure
+// satisfies keep, in order. Whole subtrees are skipped when keep
+// rejects their summary, so keep must be monotone: if it rejects a
+// combined summary it must also reject each of its parts.
+func (t *AugBTree[T, M]) Select(keep func(M) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		t.sums.selectNode(keep, t.monoid, yield)
+	}
+}
+
+func (t *AugBTree[T, M]) AsTransient() *TAugBTree[T, M] {
+	return &TAugBTree[T, M]{
+		orig:   t,
+		impl:   t.impl.AsTransient(),
+		monoid: t.monoid,
+		sums:   t.sums,
+	}
+}
+
+// TAugBTree is the transient counterpart of AugBTree. Each edit
+// computes the summaries of the nodes it changed in place again.
+type TAugBTree[T, M any] struct {
+	orig   *AugBTree[T, M]
+	impl   *TBTree[T]
+	monoid Monoid[T, M]
+	sums   *sumNode[T, M]
+}
+
+func (t *TAugBTree[T, M]) Contains(key T) bool {
+	return t.impl.Contains(key)
+}
+
+func (t *TAugBTree[T, M]) At(key T) T {
+	return t.impl.At(key)
+}
+
+func (t *TAugBTree[T, M]) Find(key T) (T, bool) {
+	return t.impl.Find(key)
+}
+
+func (t *TAugBTree[T, M]) Add(key T) *TAugBTree[T, M] {
+	t.edit(key, t.impl.Add)
+	return t
+}
+
+func (t *TAugBTree[T, M]) Delete(key T) *TAugBTree[T, M] {
+	t.edit(key, t.impl.Delete)
+	return t
+}
+
+// edit applies op to key and updates the summaries of the nodes it
+// changed.
+func (t *TAugBTree[T, M]) edit(key T, op func(key T) *TBTree[T]) {
+	t.impl.ensureEditable()
+	dirty := touched(t.impl.root, func(n *node[T]) int8 {
+		return n.searchFirst(key, t.impl.cmp)
+	})
+	version := t.impl.version
+	op(key)
+	if t.impl.version != version {
+		t.sums = updateSums(t.sums, t.impl.root, dirty, t.monoid)
+	}
+}
+
+func (t *TAugBTree[T, M]) Length() int {
+	return t.impl.Length()
+}
+
+func (t *TAugBTree[T, M]) String() string {
+	return t.impl.String()
+}
+
+// Iterator returns a stack allocated iterator. One may range over
+// this using (Iterator[T]).Seq().
+func (t *TAugBTree[T, M]) Iterator() Iterator[T] {
+	return t.impl.Iterator()
+}
+
+// All allows one to range over the tree.
+func (t *TAugBTree[T, M]) All() iter.Seq[T] {
+	return t.impl.All()
+}
+
+// IteratorFrom allows one to start iterating with the first element
+// greater than or equal to "from".
+func (t *TAugBTree[T, M]) IteratorFrom(from T) Iterator[T] {
+	return t.impl.IteratorFrom(from)
+}
+
+// From allows one to range over the tree starting with the first
+// element greater than or equal to "from".
+func (t *TAugBTree[T, M]) From(from T) iter.Seq[T] {
+	return t.impl.From(from)
+}
+
+// Summary returns the summary of every element in the tree.
+func (t *TAugBTree[T, M]) Summary() M {
+	t.impl.ensureEditable()
+	return t.sums.sum
+}
+
+// Aggregate returns the combined summary of the elements between lo
+// and hi inclusive.
+func (t *TAugBTree[T, M]) Aggregate(lo, hi T) M {
+	t.impl.ensureEditable()
+	return t.sums.aggregate(lo, hi, false, false, t.impl.cmp, t.monoid)
+}
+
+// Select allows one to range over the elements whose measure
+// satisfies keep, in order. See (*AugBTree[T, M]).Select.
+func (t *TAugBTree[T, M]) Select(keep func(M) bool) iter.Seq[T] {
+	t.impl.ensureEditable()
+	return func(yield func(T) bool) {
+		t.sums.selectNode(keep, t.monoid, yield)
+	}
+}
+
+func (t *TAugBTree[T, M]) AsPersistent() *AugBTree[T, M] {
+	nimpl := t.impl.AsPersistent()
+	if nimpl == t.orig.impl {
+		return t.orig
+	}
+	return &AugBTree[T, M]{
+		impl:   nimpl,
+		monoid: t.monoid,
+		sums:   t.sums,
+	}
+}
+
+// sumNode is the summary of a node of an augmented tree. The summary
+// nodes of a tree mirror its nodes and are shared between versions
+// in the same way, so a version only has summary nodes of its own for
+// the nodes its edits created or changed in place. They are never
+// changed once built, so readers need no locks.
+type sumNode[T, M any] struct {
+	n        *node[T]
+	sum      M
+	children []*sumNode[T, M]
+}
+
+// updateSums returns the summaries of the tree under root, which an
+// edit made from the tree summarized by old. dirty holds the nodes
+// the edit may have changed in place. The summaries of the nodes both
+// trees share are kept, and only those of the O(log n) nodes the edit
+// created or changed are computed again.
+//
+// The nodes that are not shared are found level by level from the
+// top, looking only below those found on the level above. On each
+// level the nodes of both trees are in order and the edit changed a
+// run of neighbours, so the shared ones are the common prefix and
+// suffix.
+func updateSums[T, M any](
+	old *sumNode[T, M],
+	root *node[T],
+	dirty []*node[T],
+	monoid Monoid[T, M],
+) *sumNode[T, M] {
+	shared := func(n *node[T], s *sumNode[T, M]) bool {
+		return s.n == n && !slices.Contains(dirty, n)
+	}
+	top := height(root)
+	oldTop := 0
+	if old != nil {
+		oldTop = old.height()
+	}
+	// levels[h-1] holds the nodes of level h below a node that is
+	// not shared, and the summaries of those that are.
+	type level struct {
+		nodes []*node[T]
+		sums  []*sumNode[T, M]
+	}
+	levels := make([]level, max(oldTop, top))
+	var olds []*sumNode[T, M]
+	var news []*node[T]
+	for h := len(levels); h > 0; h-- {
+		if h == oldTop {
+			olds = append(olds, old)
+		}
+		if h == top {
+			news = append(news, root)
+		}
+		sums := make([]*sumNode[T, M], len(news))
+		i := 0
+		for i < len(news) && i < len(olds) && shared(news[i], olds[i]) {
+			sums[i] = olds[i]
+			i++
+		}
+		jn, jo := len(news)-1, len(olds)-1
+		for jn >= i && jo >= i && shared(news[jn], olds[jo]) {
+			sums[jn] = olds[jo]
+			jn, jo = jn-1, jo-1
+		}
+		levels[h-1] = level{nodes: news, sums: sums}
+
+		var nextOlds []*sumNode[T, M]
+		for _, s := range olds[i : jo+1] {
+			nextOlds = append(nextOlds, s.children...)
+		}
+		var nextNews []*node[T]
+		for _, n := range news[i : jn+1] {
+			if n.isInternalNode() {
+				in := n.asInternalNode()
+				for c := range n.len {
+					nextNews = append(nextNews, in.child(c))
+				}
+			}
+		}
+		olds, news = nextOlds, nextNews
+	}
+
+	// Summarize the nodes that are not shared from the bottom up,
+	// taking their children's summaries from the level below in
+	// order.
+	var below []*sumNode[T, M]
+	for _, l := range levels {
+		for i, n := range l.nodes {
+			if l.sums[i] != nil {
+				continue
+			}
+			s := &sumNode[T, M]{n: n, sum: monoid.Identity()}
+			if n.isInternalNode() {
+				s.children = slices.Clone(below[:n.len])
+				below = below[n.len:]
+				for _, child := range s.children {
+					s.sum = monoid.Combine(s.sum, child.sum)
+				}
+			} else {
+				for _, key := range n.keys[:n.len] {
+					s.sum = monoid.Combine(s.sum, monoid.Measure(key))
+				}
+			}
+			l.sums[i] = s
+		}
+		below = l.sums
+	}
+	return below[0]
+}
+
+// height returns the number of levels of the tree summarized by s,
+// counting the leaves.
+func (s *sumNode[T, M]) height() int {
+	h := 1
+	for ; len(s.children) > 0; h++ {
+		s = s.children[0]
+	}
+	return h
+}
+
+// aggregate combines the summaries of the elements under s between lo
+// and hi. loIn and hiIn are set when every element under s is already
+// known to be above lo or below hi respectively, in which case the
+// summary of s can be used.
+func (s *sumNode[T, M]) aggregate(
+	lo, hi T,
+	loIn, hiIn bool,
+	cmp compareFunc[T],
+	monoid Monoid[T, M],
+) M {
+	if loIn && hiIn {
+		return s.sum
+	}
+	n := s.n
+	acc := monoid.Identity()
+	if !n.isInternalNode() {
+		for _, key := range n.keys[:n.len] {
+			if !loIn && cmp(key, lo) < 0 {
+				continue
+			}
+			if !hiIn && cmp(key, hi) > 0 {
+				break
+			}
+			acc = monoid.Combine(acc, monoid.Measure(key))
+		}
+		return acc
+	}
+	var start int8
+	if !loIn {
+		start = n.searchFirst(lo, cmp)
+	}
+	for i := start; i < n.len; i++ {
+		if !hiIn && i > 0 && cmp(n.keys[i-1], hi) >= 0 {
+			break
+		}
+		childLo := loIn || (i > start)
+		childHi := hiIn || cmp(n.keys[i], hi) <= 0
+		acc = monoid.Combine(acc, s.children[i].aggregate(
+			lo, hi, childLo, childHi, cmp, monoid))
+	}
+	return acc
+}
+
+// selectNode yields the elements under s accepted by keep, pruning
+// subtrees whose summary is rejected. It returns false once yield
+// has asked to stop.
+func (s *sumNode[T, M]) selectNode(
+	keep func(M) bool,
+	monoid Monoid[T, M],
+	yield func(T) bool,
+) bool {
+	n := s.n
+	if n.len == 0 || !keep(s.sum) {
+		return true
+	}
+	if !n.isInternalNode() {
+		for _, key := range n.keys[:n.len] {
+			if keep(monoid.Measure(key)) && !yield(key) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, child := range s.children {
+		if !child.selectNode(keep, monoid, yield) {
+			return false
+		}
+	}
+	return true
+}
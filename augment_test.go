@@ -0,0 +1,149 @@
+package btree_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+)
+
+type sumMonoid struct{}
+
+func (sumMonoid) Identity() int        { return 0 }
+func (sumMonoid) Measure(v int) int    { return v }
+func (sumMonoid) Combine(a, b int) int { return a + b }
+
+func sumRange(elems map[int]struct{}, lo, hi int) int {
+	var sum int
+	for v := range elems {
+		if v >= lo && v <= hi {
+			sum += v
+		}
+	}
+	return sum
+}
+
+func TestAggregate(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Aggregate(lo, hi) == sum of [lo, hi]", prop.ForAll(
+		func(is []int, lo, hi int) bool {
+			elems := make(map[int]struct{})
+			tree := btree.EmptyAugmented(compare[int], eq[int], sumMonoid{})
+			for _, i := range is {
+				tree = tree.Add(i)
+				elems[i] = struct{}{}
+			}
+			return tree.Aggregate(lo, hi) == sumRange(elems, lo, hi) &&
+				tree.Summary() == sumRange(elems, -1<<20, 1<<20)
+		},
+		gen.SliceOf(gen.IntRange(-5000, 5000)),
+		gen.IntRange(-6000, 6000),
+		gen.IntRange(-6000, 6000),
+	))
+	properties.Property("transient edits keep summaries correct", prop.ForAll(
+		func(adds, dels []int, lo, hi int) bool {
+			elems := make(map[int]struct{})
+			tree := btree.EmptyAugmented(compare[int], eq[int], sumMonoid{}).
+				AsTransient()
+			for _, i := range adds {
+				tree.Add(i)
+				elems[i] = struct{}{}
+			}
+			p := tree.AsPersistent()
+			before := p.Aggregate(lo, hi)
+			trans := p.AsTransient()
+			trans.Aggregate(lo, hi) // populate the caches
+			for _, i := range dels {
+				trans.Delete(i)
+				delete(elems, i)
+				if trans.Aggregate(lo, hi) != sumRange(elems, lo, hi) {
+					return false
+				}
+			}
+			for _, i := range adds[:len(adds)/2] {
+				trans.Add(i)
+				elems[i] = struct{}{}
+			}
+			return trans.Aggregate(lo, hi) == sumRange(elems, lo, hi) &&
+				trans.AsPersistent().Aggregate(lo, hi) == sumRange(elems, lo, hi) &&
+				p.Aggregate(lo, hi) == before
+		},
+		gen.SliceOfN(5000, gen.IntRange(0, 10000)),
+		gen.SliceOfN(200, gen.IntRange(0, 10000)),
+		gen.IntRange(0, 5000),
+		gen.IntRange(5000, 10000),
+	))
+	properties.TestingRun(t)
+}
+
+func TestAggregateVersions(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("versions sharing summaries stay correct",
+		prop.ForAll(
+			func(is []int, order []int) bool {
+				versions := []*btree.AugBTree[int, int]{
+					btree.EmptyAugmented(compare[int], eq[int], sumMonoid{}),
+				}
+				sums := []int{0}
+				elems := make(map[int]struct{})
+				for _, i := range is {
+					tree := versions[len(versions)-1].Add(i)
+					elems[i] = struct{}{}
+					versions = append(versions, tree)
+					sums = append(sums, sumRange(elems, 0, 10000))
+				}
+				for _, i := range order {
+					v := i % len(versions)
+					if versions[v].Summary() != sums[v] ||
+						versions[v].Aggregate(0, 10000) != sums[v] {
+						return false
+					}
+				}
+				return true
+			},
+			gen.SliceOfN(1000, gen.IntRange(0, 10000)),
+			gen.SliceOfN(50, gen.IntRange(0, 1<<20)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestAggregateConcurrent(t *testing.T) {
+	trans := btree.EmptyAugmented(compare[int], eq[int], sumMonoid{}).
+		AsTransient()
+	for i := 0; i < 10000; i++ {
+		trans.Add(i)
+	}
+	tree := trans.AsPersistent()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version := tree
+			for i := 0; i < 200; i++ {
+				lo := (g*1000 + i*7) % 10000
+				hi := min(lo+100, 9999)
+				want := (lo + hi) * (hi - lo + 1) / 2
+				if got := tree.Aggregate(lo, hi); got != want {
+					errs <- fmt.Errorf("Aggregate(%v, %v) = %v, expected %v",
+						lo, hi, got, want)
+					return
+				}
+				// Derive versions sharing the summaries of tree.
+				version = version.Delete(lo)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
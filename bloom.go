@@ -0,0 +1,159 @@
+package btree
+
+import (
+	"slices"
+
+	"jsouthworth.net/go/btree/internal/bloom"
+)
+
+// Bloom is a bloom filter over the elements of a tree. It answers
+// MayContain without touching the tree, which saves the search for
+// most absent keys when the tree is expensive to search, for instance
+// a tree opened with PageCache.Open whose nodes live on disk. The
+// hash must agree with the tree's comparator: elements that compare
+// equal must hash equally.
+type Bloom[T any] struct {
+	filter *bloom.Filter
+	// extra holds the hashes added by persistent edits since
+	// filter was copied. They share filter instead of copying it
+	// until there are maxExtra of them.
+	extra    []uint64
+	hash     func(elem T) uint64
+	capacity int
+	fpRate   float64
+}
+
+// maxExtra is the number of hashes persistent edits add to a filter
+// before it is copied. MayContain checks them one by one when the bit
+// array does not hold a key, so there must be few of them.
+const maxExtra = 32
+
+func newBloom[T any](
+	root *node[T],
+	count int,
+	hash func(elem T) uint64,
+	fpRate float64,
+) *Bloom[T] {
+	b := &Bloom[T]{
+		filter:   bloom.New(count, fpRate),
+		hash:     hash,
+		capacity: max(count, 1),
+		fpRate:   fpRate,
+	}
+	i := makeIterator[T](nil, root)
+	for i.HasNext() {
+		b.add(i.Next())
+	}
+	return b
+}
+
+// MayContain reports whether key may be in the tree. It is never
+// false for an element of the tree.
+func (b *Bloom[T]) MayContain(key T) bool {
+	if b == nil {
+		return true
+	}
+	h := b.hash(key)
+	return b.filter.MayContain(h) || slices.Contains(b.extra, h)
+}
+
+func (b *Bloom[T]) add(key T) {
+	b.filter.Add(b.hash(key))
+}
+
+// with returns a filter that also holds key. The bit array is shared
+// with b and the hash added to a copy of extra, unless extra is full,
+// in which case it is folded into a copy of the bit array instead.
+// The bit array is thus copied once every maxExtra calls.
+func (b *Bloom[T]) with(key T) *Bloom[T] {
+	if len(b.extra) == maxExtra {
+		out := b.clone()
+		out.add(key)
+		return out
+	}
+	out := *b
+	out.extra = append(slices.Clip(b.extra), b.hash(key))
+	return &out
+}
+
+// clone returns a copy of b that may be added to in place, folding
+// the hashes in extra into its bit array.
+func (b *Bloom[T]) clone() *Bloom[T] {
+	out := *b
+	out.filter = b.filter.Clone()
+	for _, h := range b.extra {
+		out.filter.Add(h)
+	}
+	out.extra = nil
+	return &out
+}
+
+// WithBloom returns a tree holding the same elements as t that checks
+// a bloom filter with the false positive rate fpRate before searching
+// for a key. Building the filter visits every element of t.
+//
+// The filter is kept up to date as elements are added. Adding to a
+// persistent tree shares the filter and records the new element in a
+// short list on the side, which MayContain also checks; once the list
+// is full the next addition folds it into a copy of the filter. Large
+// numbers of additions should therefore be made through a transient,
+// which copies the filter once and then updates it in place. Deleted
+// elements stay in the filter, and a transient rebuilds it once the
+// tree has outgrown it.
+func (t *BTree[T]) WithBloom(
+	hash func(elem T) uint64,
+	fpRate float64,
+) *BTree[T] {
+	out := *t
+	out.bloom = newBloom(t.root, t.count, hash, fpRate)
+	return &out
+}
+
+// Bloom returns the bloom filter of t, or nil if it has none. The
+// filter may be given to WithBloomFilter for a tree read back from
+// the pages of t.
+func (t *BTree[T]) Bloom() *Bloom[T] {
+	return t.bloom
+}
+
+// WithBloomFilter returns a tree holding the same elements as t that
+// checks b before searching for a key. Unlike WithBloom it does not
+// visit the elements of t, so b must already cover all of them, as
+// the filter of the tree t's pages were built from does.
+func (t *BTree[T]) WithBloomFilter(b *Bloom[T]) *BTree[T] {
+	out := *t
+	out.bloom = b
+	return &out
+}
+
+// MayContain reports whether key may be in the tree. It is always true
+// if the tree has no bloom filter.
+func (t *BTree[T]) MayContain(key T) bool {
+	return t.bloom.MayContain(key)
+}
+
+// MayContain reports whether key may be in the tree. See
+// (*BTree[T]).MayContain.
+func (t *TBTree[T]) MayContain(key T) bool {
+	t.ensureEditable()
+	return t.bloom.MayContain(key)
+}
+
+// addToBloom records key in the filter of a transient, copying the
+// filter first if it is shared and rebuilding it, with room to grow,
+// once the tree holds more elements than it was sized for.
+func (t *TBTree[T]) addToBloom(key T) {
+	switch {
+	case t.bloom == nil:
+	case t.count > t.bloom.capacity:
+		t.bloom = newBloom(t.root, 2*t.count, t.bloom.hash, t.bloom.fpRate)
+		t.bloomOwned = true
+		t.bloomBuilds++
+	default:
+		if !t.bloomOwned {
+			t.bloom = t.bloom.clone()
+			t.bloomOwned = true
+		}
+		t.bloom.add(key)
+	}
+}
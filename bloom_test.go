@@ -0,0 +1,209 @@
+package btree_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+	"jsouthworth.net/go/btree/treeset"
+)
+
+func hashInt(v int) uint64 {
+	return uint64(v)
+}
+
+func TestBloom(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("bloom filtered trees find every element",
+		prop.ForAll(
+			func(base, adds, dels []int) bool {
+				plain := buildTree(base)
+				tree := plain.WithBloom(hashInt, 0.01)
+				for _, v := range adds[:len(adds)/2] {
+					plain, tree = plain.Add(v), tree.Add(v)
+				}
+				for _, v := range dels {
+					plain, tree = plain.Delete(v), tree.Delete(v)
+				}
+				trans := tree.AsTransient()
+				for _, v := range adds[len(adds)/2:] {
+					plain = plain.Add(v)
+					trans.Add(v)
+				}
+				tree = trans.AsPersistent()
+				for v := -10; v < 2010; v++ {
+					if tree.Contains(v) != plain.Contains(v) ||
+						plain.Contains(v) && !tree.MayContain(v) {
+						return false
+					}
+				}
+				return true
+			},
+			gen.SliceOf(gen.IntRange(0, 2000)),
+			gen.SliceOf(gen.IntRange(0, 2000)),
+			gen.SliceOf(gen.IntRange(0, 2000)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestBloomFalsePositives(t *testing.T) {
+	const n = 20000
+	var elems []int
+	for i := 0; i < n; i++ {
+		elems = append(elems, 2*i)
+	}
+	tree := buildTree(elems[:n/8]).WithBloom(hashInt, 0.01)
+	trans := tree.AsTransient()
+	for _, v := range elems[n/8:] {
+		trans.Add(v) // outgrows the filter, which is rebuilt
+	}
+	grown := trans.AsPersistent()
+	var fp int
+	for i := 0; i < n; i++ {
+		if !grown.MayContain(2 * i) {
+			t.Fatalf("false negative for %v", 2*i)
+		}
+		if grown.MayContain(2*i + 1) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Fatalf("got false positive rate %v expected 0.01", rate)
+	}
+	// The transient copied the filter rather than filling the one
+	// shared with tree.
+	for _, v := range elems[n/8:] {
+		if tree.Contains(v) {
+			t.Fatalf("original tree gained %v", v)
+		}
+	}
+}
+
+func TestPagedBloom(t *testing.T) {
+	var elems []int
+	for i := 0; i < 10000; i++ {
+		elems = append(elems, 2*i)
+	}
+	paged, _, src := openPaged(t, elems, 16)
+	paged = paged.WithBloomFilter(buildTree(elems).WithBloom(hashInt, 0.01).Bloom())
+	reads := src.reads.Load()
+	var fp int
+	for i := 0; i < 10000; i++ {
+		if paged.Contains(2*i + 1) {
+			t.Fatalf("found absent %v", 2*i+1)
+		}
+		if paged.MayContain(2*i + 1) {
+			fp++
+		}
+	}
+	if got := src.reads.Load() - reads; got > int64(fp)*4 {
+		t.Fatalf("loaded %v pages for %v false positives", got, fp)
+	}
+	if !paged.Contains(500) {
+		t.Fatal("expected to find 500")
+	}
+}
+
+func TestBloomPersistentAdd(t *testing.T) {
+	const n = 1_000_000
+	var elems []int
+	for i := 0; i < n; i++ {
+		elems = append(elems, 2*i)
+	}
+	tree := buildTree(elems).WithBloom(hashInt, 0.01)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	grown := tree
+	for i := 0; i < 1000; i++ {
+		grown = grown.Add(2*i + 1)
+	}
+	runtime.ReadMemStats(&after)
+	// Copying the filter would cost over a megabyte per Add.
+	if got := after.TotalAlloc - before.TotalAlloc; got > 100<<20 {
+		t.Fatalf("1000 persistent adds allocated %v bytes", got)
+	}
+	trans := grown.AsTransient()
+	trans.Add(-1)
+	folded := trans.AsPersistent()
+	for i := 0; i < 1000; i++ {
+		if !grown.MayContain(2*i+1) || !folded.MayContain(2*i+1) {
+			t.Fatalf("false negative for %v", 2*i+1)
+		}
+	}
+	if !folded.MayContain(-1) || tree.Contains(1) {
+		t.Fatal("filter shared between versions was changed")
+	}
+}
+
+func TestBloomWrappers(t *testing.T) {
+	m := treemap.Empty[int, int](compare[int], eq[int])
+	s := treeset.Empty(compare[int])
+	for i := 0; i < 1000; i += 2 {
+		m = m.Assoc(i, i)
+		s = s.Add(i)
+	}
+	m = m.WithBloom(hashInt, 0.01)
+	s = s.WithBloom(hashInt, 0.01)
+	m, s = m.Assoc(1001, 1), s.Add(1001)
+	for i := 0; i < 1002; i++ {
+		want := i%2 == 0 && i < 1000 || i == 1001
+		if m.Contains(i) != want || s.Contains(i) != want {
+			t.Fatalf("got Map %v Set %v for %v, expected %v",
+				m.Contains(i), s.Contains(i), i, want)
+		}
+	}
+}
+
+func TestBloomSavepoints(t *testing.T) {
+	const n = 1_000_000
+	var elems []int
+	for i := 0; i < n; i++ {
+		elems = append(elems, 2*i)
+	}
+	trans := buildTree(elems).WithBloom(hashInt, 0.01).AsTransient()
+	trans.Add(-1) // copies the filter
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var sps []*btree.Savepoint[int]
+	for i := 0; i < 100; i++ {
+		sps = append(sps, trans.Savepoint())
+		trans.Add(2*i + 1)
+	}
+	runtime.ReadMemStats(&after)
+	// Copying the filter would cost over a megabyte per savepoint.
+	if got := after.TotalAlloc - before.TotalAlloc; got > 1<<20 {
+		t.Fatalf("100 savepoints allocated %v bytes", got)
+	}
+	trans.RollbackTo(sps[50])
+	for i := 0; i < 100; i++ {
+		if got := trans.Contains(2*i + 1); got != (i < 50) {
+			t.Fatalf("got %v for %v after rolling back", got, 2*i+1)
+		}
+	}
+	if !trans.Contains(-1) || !trans.Contains(2) {
+		t.Fatal("lost elements added before the savepoint")
+	}
+
+	// Growing past the filter's capacity rebuilds it without the
+	// elements deleted since the savepoint.
+	small := buildTree([]int{0, 1, 2}).WithBloom(hashInt, 0.01).AsTransient()
+	sp := small.Savepoint()
+	small.Delete(1)
+	small.Add(3).Add(4)
+	small.RollbackTo(sp)
+	if !small.Contains(1) {
+		t.Fatal("lost an element deleted before the filter was rebuilt")
+	}
+	// Rolling back to sp rebuilt the filter again, without 3.
+	small.Add(3)
+	sp3 := small.Savepoint()
+	small.RollbackTo(sp).RollbackTo(sp3)
+	if !small.Contains(3) {
+		t.Fatal("lost an element after rolling back twice")
+	}
+}
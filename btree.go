@@ -5,6 +5,7 @@ import (
 	"cmp"
 	"fmt"
 	"iter"
+	"runtime/debug"
 	"strings"
 
 	"jsouthworth.net/go/btree/internal/atomic"
@@ -18,6 +19,36 @@ func (e Error) Error() string {
 
 const ErrTafterP = Error("transient used after persistent call")
 
+// ErrForeignSavepoint is the panic raised when a transient is rolled
+// back to a savepoint taken from another transient.
+const ErrForeignSavepoint = Error("savepoint taken from another transient")
+
+// TransientError reports the use of a transient after it was made
+// persistent when debugging is enabled. Stack holds the stack trace
+// of the call that froze the transient.
+type TransientError struct {
+	Stack []byte
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("%s; frozen at:\n%s", ErrTafterP, e.Stack)
+}
+
+func (e *TransientError) Unwrap() error {
+	return ErrTafterP
+}
+
+var debugTransients = atomic.NewBool(false)
+
+// SetDebug enables or disables the recording of stack traces when
+// transients are made persistent. Using such a transient afterwards
+// reports a *TransientError naming where it was frozen instead of
+// the bare ErrTafterP. Recording a stack trace is expensive, so this
+// is meant for tracking down misuse rather than for production.
+func SetDebug(enabled bool) {
+	debugTransients.Reset(enabled)
+}
+
 type BTree[T any] struct {
 	root    *node[T]
 	count   int
@@ -26,6 +57,9 @@ type BTree[T any] struct {
 
 	cmp compareFunc[T]
 	eq  eqFunc[T]
+
+	bloom *Bloom[T]
+	obs   Observer
 }
 
 var emptyEdit = atomic.NewBool(false)
@@ -40,21 +74,64 @@ func Empty[T any](cmp func(a, b T) int, eq func(a, b T) bool) *BTree[T] {
 }
 
 func (t *BTree[T]) Contains(key T) bool {
-	_, found := t.root.find(key, t.cmp)
+	_, found := t.Find(key)
 	return found
 }
 
 func (t *BTree[T]) At(key T) T {
-	out, _ := t.root.find(key, t.cmp)
+	out, _ := t.Find(key)
 	return out
 }
 
 func (t *BTree[T]) Find(key T) (T, bool) {
+	if !t.bloom.MayContain(key) {
+		var zero T
+		return zero, false
+	}
 	return t.root.find(key, t.cmp)
 }
 
+// Min returns the smallest element in the tree. The boolean is false
+// if the tree is empty.
+func (t *BTree[T]) Min() (T, bool) {
+	return t.root.first()
+}
+
+// Max returns the largest element in the tree. The boolean is false
+// if the tree is empty.
+func (t *BTree[T]) Max() (T, bool) {
+	return t.root.last()
+}
+
+// Floor returns the largest element less than or equal to key. The
+// boolean is false if there is no such element.
+func (t *BTree[T]) Floor(key T) (T, bool) {
+	return t.root.before(key, true, t.cmp)
+}
+
+// Lower returns the largest element strictly less than key. The
+// boolean is false if there is no such element.
+func (t *BTree[T]) Lower(key T) (T, bool) {
+	return t.root.before(key, false, t.cmp)
+}
+
 func (t *BTree[T]) Add(key T) *BTree[T] {
-	ret := t.root.add(key, t.cmp, t.eq, t.edit)
+	return t.add(key, nil)
+}
+
+// AddFunc is like Add, but if the tree holds an element equal to key
+// it is replaced by merge(old, key). The element is found and merged
+// in a single descent.
+func (t *BTree[T]) AddFunc(key T, merge func(old, new T) T) *BTree[T] {
+	return t.add(key, merge)
+}
+
+func (t *BTree[T]) add(key T, merge mergeFunc[T]) *BTree[T] {
+	var o *observation[T]
+	if t.obs != nil {
+		o = observeAdd(t.obs, t.root, key, t.cmp)
+	}
+	ret := t.root.add(key, merge, t.cmp, t.eq, t.edit)
 	var newRoot *node[T]
 	switch ret.status {
 	case returnUnchanged:
@@ -62,6 +139,9 @@ func (t *BTree[T]) Add(key T) *BTree[T] {
 	case returnOne:
 		newRoot = ret.nodes[0]
 	case returnReplaced:
+		if o != nil {
+			o.report(ret.nodes[0], t.eq)
+		}
 		return &BTree[T]{
 			root:    ret.nodes[0],
 			count:   t.count,
@@ -69,6 +149,8 @@ func (t *BTree[T]) Add(key T) *BTree[T] {
 			edit:    t.edit,
 			cmp:     t.cmp,
 			eq:      t.eq,
+			bloom:   t.bloom,
+			obs:     t.obs,
 		}
 	default:
 		nr := newNode[T](2, t.edit)
@@ -77,6 +159,13 @@ func (t *BTree[T]) Add(key T) *BTree[T] {
 		copy(nr.children, ret.nodes[:])
 		newRoot = nr.asNode()
 	}
+	if o != nil {
+		o.report(newRoot, t.eq)
+	}
+	bloom := t.bloom
+	if bloom != nil {
+		bloom = bloom.with(key)
+	}
 	return &BTree[T]{
 		root:    newRoot,
 		count:   t.count + 1,
@@ -84,25 +173,70 @@ func (t *BTree[T]) Add(key T) *BTree[T] {
 		edit:    t.edit,
 		cmp:     t.cmp,
 		eq:      t.eq,
+		bloom:   bloom,
+		obs:     t.obs,
 	}
 }
 
 func (t *BTree[T]) Delete(key T) *BTree[T] {
-	ret := t.root.remove(key, nil, nil, t.cmp, t.edit)
+	return t.remove(&removal[T]{key: key})
+}
+
+// UpdateFunc returns a tree in which the element equal to key is
+// replaced by the result of update, or deleted if update returns
+// false. The tree is returned unchanged if it holds no element equal
+// to key. The element is found and updated in a single descent.
+func (t *BTree[T]) UpdateFunc(key T, update func(old T) (T, bool)) *BTree[T] {
+	return t.remove(&removal[T]{key: key, update: update})
+}
+
+// PopMin returns the smallest element and a tree without it. The
+// element is found and removed in a single descent of the leftmost
+// spine. The boolean is false, and t is returned, if the tree is
+// empty.
+func (t *BTree[T]) PopMin() (T, *BTree[T], bool) {
+	r := removal[T]{edge: removeFirst}
+	out := t.remove(&r)
+	return r.elem, out, out != t
+}
+
+// PopMax returns the largest element and a tree without it. See
+// PopMin.
+func (t *BTree[T]) PopMax() (T, *BTree[T], bool) {
+	r := removal[T]{edge: removeLast}
+	out := t.remove(&r)
+	return r.elem, out, out != t
+}
+
+func (t *BTree[T]) remove(r *removal[T]) *BTree[T] {
+	var o *observation[T]
+	if t.obs != nil {
+		o = observeRemove(t.obs, t.root, r, t.cmp)
+	}
+	ret := t.root.remove(r, nil, nil, t.cmp, t.edit)
 	if ret.status == returnUnchanged {
 		return t
 	}
 	newRoot := ret.nodes[1] // center
 	if newRoot.isInternalNode() && newRoot.len == 1 {
-		newRoot = newRoot.asInternalNode().children[0]
+		newRoot = newRoot.asInternalNode().child(0)
+	}
+	if o != nil {
+		o.report(newRoot, t.eq)
+	}
+	count := t.count - 1
+	if r.kept {
+		count = t.count
 	}
 	return &BTree[T]{
 		root:    newRoot,
-		count:   t.count - 1,
+		count:   count,
 		version: t.version + 1,
 		edit:    t.edit,
 		cmp:     t.cmp,
 		eq:      t.eq,
+		bloom:   t.bloom,
+		obs:     t.obs,
 	}
 }
 
@@ -200,7 +334,7 @@ func (i *Iterator[T]) HasNext() bool {
 	case nodeKindInternal:
 		n := state.n.asInternalNode()
 		if state.cur < n.len {
-			child := n.children[state.cur]
+			child := n.child(state.cur)
 			i.stack[i.depth].cur++
 			i.pushNode(child)
 			switch child.kind {
@@ -236,6 +370,23 @@ func (i *Iterator[T]) popNode() {
 	i.depth = i.depth - 1
 }
 
+// Seek advances the iterator to the first remaining element greater
+// than or equal to target. The iterator never moves backwards, so
+// Seek does nothing if the next element is already at least target.
+// Seeking costs O(log n) however far the iterator moves.
+func (i *Iterator[T]) Seek(target T) {
+	if !i.HasNext() || i.cmp(i.peek(), target) >= 0 {
+		return
+	}
+	// Climb to the lowest node that still holds an element at least
+	// target; everything before it in the node has been passed.
+	for i.depth > 0 && i.cmp(i.stack[i.depth].n.maxKey(), target) < 0 {
+		i.popNode()
+	}
+	i.findFirst(target)
+	i.HasNext() // Make sure the iterator value is valid
+}
+
 func (i *Iterator[T]) findFirst(from T) {
 	for {
 		state := i.stack[i.depth]
@@ -252,7 +403,7 @@ func (i *Iterator[T]) findFirst(from T) {
 				i.stack[i.depth].cur = n.sizeOfChildArray()
 				return
 			}
-			child := n.children[first]
+			child := n.child(first)
 			i.stack[i.depth].cur = first + 1
 			i.pushNode(child)
 		}
@@ -267,8 +418,19 @@ type TBTree[T any] struct {
 
 	cmp compareFunc[T]
 	eq  eqFunc[T]
+	obs Observer
 
 	orig *BTree[T]
+
+	// bloom is shared with orig until bloomOwned is set.
+	// bloomBuilds counts the times it was rebuilt from root.
+	bloom       *Bloom[T]
+	bloomOwned  bool
+	bloomBuilds int
+
+	// frozenAt is the stack trace of the AsPersistent call when
+	// debugging is enabled.
+	frozenAt []byte
 }
 
 func (t *BTree[T]) AsTransient() *TBTree[T] {
@@ -279,31 +441,74 @@ func (t *BTree[T]) AsTransient() *TBTree[T] {
 		edit:    atomic.NewBool(true),
 		cmp:     t.cmp,
 		eq:      t.eq,
+		obs:     t.obs,
 
-		orig: t,
+		orig:  t,
+		bloom: t.bloom,
 	}
 }
 
 func (t *TBTree[T]) Contains(key T) bool {
-	t.ensureEditable()
-	_, found := t.root.find(key, t.cmp)
+	_, found := t.Find(key)
 	return found
 }
 
 func (t *TBTree[T]) At(key T) T {
-	t.ensureEditable()
-	out, _ := t.root.find(key, t.cmp)
+	out, _ := t.Find(key)
 	return out
 }
 
 func (t *TBTree[T]) Find(key T) (T, bool) {
 	t.ensureEditable()
+	if !t.bloom.MayContain(key) {
+		var zero T
+		return zero, false
+	}
 	return t.root.find(key, t.cmp)
 }
 
+// Min returns the smallest element in the tree. The boolean is false
+// if the tree is empty.
+func (t *TBTree[T]) Min() (T, bool) {
+	t.ensureEditable()
+	return t.root.first()
+}
+
+// Max returns the largest element in the tree. The boolean is false
+// if the tree is empty.
+func (t *TBTree[T]) Max() (T, bool) {
+	t.ensureEditable()
+	return t.root.last()
+}
+
+func (t *TBTree[T]) Floor(key T) (T, bool) {
+	t.ensureEditable()
+	return t.root.before(key, true, t.cmp)
+}
+
+func (t *TBTree[T]) Lower(key T) (T, bool) {
+	t.ensureEditable()
+	return t.root.before(key, false, t.cmp)
+}
+
 func (t *TBTree[T]) Add(key T) *TBTree[T] {
 	t.ensureEditable()
-	ret := t.root.add(key, t.cmp, t.eq, t.edit)
+	return t.add(key, nil)
+}
+
+// AddFunc is like Add, but if the tree holds an element equal to key
+// it is replaced by merge(old, key). See BTree.AddFunc.
+func (t *TBTree[T]) AddFunc(key T, merge func(old, new T) T) *TBTree[T] {
+	t.ensureEditable()
+	return t.add(key, merge)
+}
+
+func (t *TBTree[T]) add(key T, merge mergeFunc[T]) *TBTree[T] {
+	var o *observation[T]
+	if t.obs != nil {
+		o = observeAdd(t.obs, t.root, key, t.cmp)
+	}
+	ret := t.root.add(key, merge, t.cmp, t.eq, t.edit)
 	switch ret.status {
 	case returnUnchanged:
 		return t
@@ -311,6 +516,9 @@ func (t *TBTree[T]) Add(key T) *TBTree[T] {
 	case returnReplaced:
 		t.root = ret.nodes[0]
 		t.version++
+		if o != nil {
+			o.report(t.root, t.eq)
+		}
 		return t
 	case returnOne:
 		t.root = ret.nodes[0]
@@ -321,29 +529,96 @@ func (t *TBTree[T]) Add(key T) *TBTree[T] {
 		copy(nr.children, ret.nodes[:])
 		t.root = nr.asNode()
 	}
+	if o != nil {
+		o.report(t.root, t.eq)
+	}
 	t.count++
 	t.version++
+	t.addToBloom(key)
 	return t
 }
 
+// TryAdd is like Add but returns an error instead of panicking if
+// the transient has already been made persistent.
+func (t *TBTree[T]) TryAdd(key T) error {
+	if err := t.checkEditable(); err != nil {
+		return err
+	}
+	t.Add(key)
+	return nil
+}
+
+// TryDelete is like Delete but returns an error instead of panicking
+// if the transient has already been made persistent.
+func (t *TBTree[T]) TryDelete(key T) error {
+	if err := t.checkEditable(); err != nil {
+		return err
+	}
+	t.Delete(key)
+	return nil
+}
+
 func (t *TBTree[T]) Delete(key T) *TBTree[T] {
 	t.ensureEditable()
-	ret := t.root.remove(key, nil, nil, t.cmp, t.edit)
+	t.remove(&removal[T]{key: key})
+	return t
+}
+
+// UpdateFunc replaces the element equal to key by the result of
+// update, or deletes it if update returns false. See
+// BTree.UpdateFunc.
+func (t *TBTree[T]) UpdateFunc(key T, update func(old T) (T, bool)) *TBTree[T] {
+	t.ensureEditable()
+	t.remove(&removal[T]{key: key, update: update})
+	return t
+}
+
+// PopMin removes and returns the smallest element in a single descent
+// of the leftmost spine. The boolean is false if the tree is empty.
+func (t *TBTree[T]) PopMin() (T, bool) {
+	t.ensureEditable()
+	r := removal[T]{edge: removeFirst}
+	ok := t.remove(&r)
+	return r.elem, ok
+}
+
+// PopMax removes and returns the largest element in a single descent
+// of the rightmost spine. The boolean is false if the tree is empty.
+func (t *TBTree[T]) PopMax() (T, bool) {
+	t.ensureEditable()
+	r := removal[T]{edge: removeLast}
+	ok := t.remove(&r)
+	return r.elem, ok
+}
+
+// remove reports whether an element was removed or, if r.kept is
+// set, replaced.
+func (t *TBTree[T]) remove(r *removal[T]) bool {
+	var o *observation[T]
+	if t.obs != nil {
+		o = observeRemove(t.obs, t.root, r, t.cmp)
+	}
+	ret := t.root.remove(r, nil, nil, t.cmp, t.edit)
 	switch ret.status {
 	case returnUnchanged:
-		return t
+		return false
 	case returnEarly:
 	default:
 		newRoot := ret.nodes[1] // center
 		if newRoot.isInternalNode() && newRoot.len == 1 {
 			nr := newRoot.asInternalNode()
-			newRoot = nr.children[0]
+			newRoot = nr.child(0)
 		}
 		t.root = newRoot
 	}
-	t.count--
+	if o != nil {
+		o.report(t.root, t.eq)
+	}
+	if !r.kept {
+		t.count--
+	}
 	t.version++
-	return t
+	return true
 }
 
 // Iterator returns a stack allocated iterator. One may range over
@@ -398,7 +673,7 @@ func (t *TBTree[T]) String() string {
 
 func (t *TBTree[T]) AsPersistent() *BTree[T] {
 	t.ensureEditable()
-	t.edit.Reset(false)
+	t.freeze()
 	if t.root == t.orig.root {
 		return t.orig
 	}
@@ -409,15 +684,126 @@ func (t *TBTree[T]) AsPersistent() *BTree[T] {
 		edit:    t.edit,
 		cmp:     t.cmp,
 		eq:      t.eq,
+		bloom:   t.bloom,
+		obs:     t.obs,
 	}
 }
 
+// TryAsPersistent is like AsPersistent but returns an error instead
+// of panicking if the transient has already been made persistent.
+func (t *TBTree[T]) TryAsPersistent() (*BTree[T], error) {
+	if err := t.checkEditable(); err != nil {
+		return nil, err
+	}
+	return t.AsPersistent(), nil
+}
+
+// Rollback discards every change made through the transient and
+// returns the tree it was made from. Like AsPersistent it ends the
+// use of the transient.
+func (t *TBTree[T]) Rollback() *BTree[T] {
+	t.ensureEditable()
+	t.freeze()
+	return t.orig
+}
+
+// Savepoint is a state of a transient recorded by Savepoint that the
+// transient may be rolled back to with RollbackTo.
+type Savepoint[T any] struct {
+	owner *TBTree[T]
+	root  *node[T]
+	count int
+	// bloomBuilds is the number of times the transient had rebuilt
+	// its bloom filter.
+	bloomBuilds int
+}
+
+// Savepoint records the current state of the transient in constant
+// time. The nodes the transient has edited so far are frozen as if
+// the transient had been made persistent, so the first later edit of
+// each copies it before editing the copy in place.
+func (t *TBTree[T]) Savepoint() *Savepoint[T] {
+	t.ensureEditable()
+	t.edit.Reset(false)
+	t.edit = atomic.NewBool(true)
+	return &Savepoint[T]{
+		owner:       t,
+		root:        t.root,
+		count:       t.count,
+		bloomBuilds: t.bloomBuilds,
+	}
+}
+
+// RollbackTo discards the changes made since sp was recorded. sp must
+// have been taken from t. Savepoints stay valid when the transient is
+// rolled back, so savepoints may be nested and returned to any number
+// of times. A bloom filter keeps the elements added since sp: like
+// deleted elements they only make false positives more likely. If the
+// filter was rebuilt since sp it lacks the elements deleted before the
+// rebuild, so it is rebuilt again from the restored tree.
+func (t *TBTree[T]) RollbackTo(sp *Savepoint[T]) *TBTree[T] {
+	t.ensureEditable()
+	if sp.owner != t {
+		panic(ErrForeignSavepoint)
+	}
+	t.root = sp.root
+	t.count = sp.count
+	t.version++
+	if t.bloom != nil && t.bloomBuilds != sp.bloomBuilds {
+		t.bloom = newBloom(t.root, t.bloom.capacity, t.bloom.hash, t.bloom.fpRate)
+		t.bloomOwned = true
+		t.bloomBuilds++
+	}
+	return t
+}
+
+func (t *TBTree[T]) freeze() {
+	if debugTransients.Deref() {
+		t.frozenAt = debug.Stack()
+	}
+	t.edit.Reset(false)
+}
+
+func (t *TBTree[T]) checkEditable() error {
+	if t.edit.Deref() {
+		return nil
+	}
+	if t.frozenAt != nil {
+		return &TransientError{Stack: t.frozenAt}
+	}
+	return ErrTafterP
+}
+
 func (t *TBTree[T]) ensureEditable() {
-	if !t.edit.Deref() {
-		panic(ErrTafterP)
+	if err := t.checkEditable(); err != nil {
+		panic(err)
 	}
 }
 
+// touched returns the nodes of a transient that an edit descending
+// from root to the children chosen by pick may change in place: the
+// editable nodes on its path and their editable neighbours, which it
+// may borrow from. The nodes below a node that is not editable are
+// not editable either.
+func touched[T any](root *node[T], pick func(n *node[T]) int8) []*node[T] {
+	var out []*node[T]
+	for n := root; n.isEditable(); {
+		out = append(out, n)
+		if !n.isInternalNode() {
+			break
+		}
+		in := n.asInternalNode()
+		idx := min(pick(n), in.len-1)
+		for _, sib := range [...]int8{idx - 1, idx + 1} {
+			if sib >= 0 && sib < in.len && in.child(sib).isEditable() {
+				out = append(out, in.child(sib))
+			}
+		}
+		n = in.child(idx)
+	}
+	return out
+}
+
 type compareFunc[T any] func(k1, k2 T) int
 type eqFunc[T any] func(k1, k2 T) bool
 
@@ -1,9 +1,13 @@
 package btree_test
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -357,6 +361,44 @@ func TestTransientDelete(t *testing.T) {
 	properties.TestingRun(t)
 }
 
+func TestTransientLeavesOriginalIntact(t *testing.T) {
+	tree := btree.Empty(compareMapEntry, eqMapEntry).AsTransient()
+	for i := 0; i < 5000; i++ {
+		tree.Add(mapEntry{key: 2 * i, val: i})
+	}
+	orig := tree.AsPersistent()
+	var expected []mapEntry
+	for e := range orig.All() {
+		expected = append(expected, e)
+	}
+	// Adding below the maximum copies the path without changing
+	// the keys of the parents, then adding a new maximum edits
+	// those parents in place.
+	trans := orig.AsTransient()
+	trans.Add(mapEntry{key: 9997, val: 0})
+	trans.Add(mapEntry{key: 20000, val: 0})
+	if orig.Contains(mapEntry{key: 20000}) {
+		t.Fatal("original contains an element added to the transient")
+	}
+	var got []mapEntry
+	for e := range orig.All() {
+		if !orig.Contains(e) {
+			t.Fatalf("%v is iterated but not found", e)
+		}
+		got = append(got, e)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("original changed length: got %v expected %v",
+			len(got), len(expected))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("original changed: got %v expected %v",
+				got[i], expected[i])
+		}
+	}
+}
+
 type mapEntry struct {
 	key int
 	val int
@@ -818,6 +860,22 @@ func TestTBTreeFrom(t *testing.T) {
 	}
 }
 
+func TestString(t *testing.T) {
+	if got := btree.Empty(compare[int], eq[int]).Add(1).Add(2).Add(3).String(); got != "{1 2 3}" {
+		t.Fatalf("got %q expected %q", got, "{1 2 3}")
+	}
+	tree := btree.Empty(compare[int], eq[int])
+	for i := 0; i < 100; i++ {
+		tree = tree.Add(i)
+	}
+	got := tree.String()
+	for i := 0; i < 100; i++ {
+		if !strings.Contains(got, fmt.Sprint(i)) {
+			t.Fatalf("%v missing from %q", i, got)
+		}
+	}
+}
+
 func TestIteratorEmpty(t *testing.T) {
 	tree := btree.Empty(compare[int], eq[int])
 	iter := tree.Iterator()
@@ -879,6 +937,53 @@ func TestAsMapSmallTransient(t *testing.T) {
 	}
 }
 
+func TestPartitions(t *testing.T) {
+	for _, size := range []int{0, 1, 63, 64, 100000} {
+		tree := btree.Empty(compare[int], eq[int]).AsTransient()
+		for i := 0; i < size; i++ {
+			tree = tree.Add(i)
+		}
+		p := tree.AsPersistent()
+		for _, n := range []int{0, 1, 2, 7, 64, 1000} {
+			parts := p.Partitions(n)
+			if len(parts) > max(n, 1) {
+				t.Fatalf("size %v: got %v partitions, asked for %v",
+					size, len(parts), n)
+			}
+			next := 0
+			for _, part := range parts {
+				for v := range part.All() {
+					if v != next {
+						t.Fatalf("size %v, n %v: got %v expected %v",
+							size, n, v, next)
+					}
+					next++
+				}
+			}
+			if next != size {
+				t.Fatalf("size %v, n %v: visited %v elements",
+					size, n, next)
+			}
+		}
+	}
+}
+
+func TestParallelForEach(t *testing.T) {
+	tree := btree.Empty(compare[int], eq[int]).AsTransient()
+	var sum int64
+	for i := 0; i < 100000; i++ {
+		tree = tree.Add(i)
+		sum += int64(i)
+	}
+	var got atomic.Int64
+	tree.AsPersistent().ParallelForEach(8, func(v int) {
+		got.Add(int64(v))
+	})
+	if got.Load() != sum {
+		t.Fatalf("didn't get expected value from iteration: got %v expected %v", got.Load(), sum)
+	}
+}
+
 type rtree struct {
 	entries []string
 	t       *btree.BTree[string]
@@ -951,3 +1056,324 @@ func unmakeTree(m *btree.BTree[string]) {
 }
 
 var genTree = gopter.DeriveGen(makeTree, unmakeTree)
+
+func TestTryAfterPersistent(t *testing.T) {
+	tree := btree.Empty(compare[int], eq[int]).AsTransient()
+	if err := tree.TryAdd(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.TryDelete(2); err != nil {
+		t.Fatal(err)
+	}
+	p, err := tree.TryAsPersistent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Contains(1) {
+		t.Fatal("persistent tree is missing 1")
+	}
+	if err := tree.TryAdd(3); !errors.Is(err, btree.ErrTafterP) {
+		t.Fatalf("got %v expected %v", err, btree.ErrTafterP)
+	}
+	if err := tree.TryDelete(1); !errors.Is(err, btree.ErrTafterP) {
+		t.Fatalf("got %v expected %v", err, btree.ErrTafterP)
+	}
+	if _, err := tree.TryAsPersistent(); !errors.Is(err, btree.ErrTafterP) {
+		t.Fatalf("got %v expected %v", err, btree.ErrTafterP)
+	}
+	if p.Contains(3) {
+		t.Fatal("failed add modified the persistent tree")
+	}
+}
+
+func freezeForTest(t *btree.TBTree[int]) *btree.BTree[int] {
+	return t.AsPersistent()
+}
+
+func TestDebugRecordsFreeze(t *testing.T) {
+	btree.SetDebug(true)
+	defer btree.SetDebug(false)
+	tree := btree.Empty(compare[int], eq[int]).AsTransient()
+	freezeForTest(tree)
+	err := tree.TryAdd(1)
+	var terr *btree.TransientError
+	if !errors.As(err, &terr) {
+		t.Fatalf("got %T expected *btree.TransientError", err)
+	}
+	if !errors.Is(err, btree.ErrTafterP) {
+		t.Fatal("TransientError does not unwrap to ErrTafterP")
+	}
+	if !strings.Contains(err.Error(), "freezeForTest") {
+		t.Fatalf("stack does not name the freezing call:\n%s", err)
+	}
+	defer func() {
+		r := recover()
+		perr, ok := r.(error)
+		if !ok || !strings.Contains(perr.Error(), "freezeForTest") {
+			t.Fatalf("panic does not name the freezing call: %v", r)
+		}
+	}()
+	tree.Add(1)
+}
+
+func TestIteratorSeek(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Seek skips to the first element at least target",
+		prop.ForAll(
+			func(elems []int, targets []int) bool {
+				tree := buildTree(elems)
+				i := tree.Iterator()
+				// The iterator has passed every element up to
+				// prev and below the largest target so far.
+				prev, floor := -1, 0
+				for _, target := range targets {
+					i.Seek(target)
+					floor = max(floor, target)
+					var expected []int
+					for elem := range tree.All() {
+						if elem > prev && elem >= floor {
+							expected = append(expected, elem)
+						}
+					}
+					if len(expected) == 0 {
+						if i.HasNext() {
+							return false
+						}
+						continue
+					}
+					if !i.HasNext() || i.Next() != expected[0] {
+						return false
+					}
+					prev = expected[0]
+				}
+				return true
+			},
+			gen.SliceOf(gen.IntRange(0, 5000)),
+			gen.SliceOf(gen.IntRange(0, 5100)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestFloorLower(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Floor and Lower find the nearest smaller elements",
+		prop.ForAll(
+			func(elems []int, key int) bool {
+				tree := buildTree(elems)
+				var floor, lower int
+				var floorOK, lowerOK bool
+				for elem := range tree.All() {
+					if elem <= key {
+						floor, floorOK = elem, true
+					}
+					if elem < key {
+						lower, lowerOK = elem, true
+					}
+				}
+				gotFloor, gotFloorOK := tree.Floor(key)
+				gotLower, gotLowerOK := tree.Lower(key)
+				return gotFloor == floor && gotFloorOK == floorOK &&
+					gotLower == lower && gotLowerOK == lowerOK
+			},
+			gen.SliceOf(gen.IntRange(0, 5000)),
+			gen.IntRange(-1, 5001),
+		))
+	properties.TestingRun(t)
+}
+
+func TestSavepoints(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("rolling back restores the savepoint",
+		prop.ForAll(
+			func(base []int, ops []int) bool {
+				// Seed enough elements for the tree to have
+				// internal nodes.
+				for v := 0; v < 3000; v += 3 {
+					base = append(base, v)
+				}
+				orig := buildTree(base).WithBloom(hashInt, 0.01)
+				trans := orig.AsTransient()
+				model := map[int]bool{}
+				for _, v := range base {
+					model[v] = true
+				}
+				var sps []*btree.Savepoint[int]
+				var models []map[int]bool
+				for _, op := range ops {
+					switch v := op % 3000; {
+					case op < 3000:
+						trans.Add(v)
+						model[v] = true
+					case op < 4500:
+						trans.Delete(v)
+						delete(model, v)
+					case op < 5250:
+						sps = append(sps, trans.Savepoint())
+						models = append(models, maps.Clone(model))
+					case len(sps) > 0:
+						i := v % len(sps)
+						trans.RollbackTo(sps[i])
+						model = maps.Clone(models[i])
+					}
+				}
+				if trans.Length() != len(model) {
+					return false
+				}
+				for v := 0; v < 3000; v++ {
+					if trans.Contains(v) != model[v] {
+						return false
+					}
+				}
+				got := trans.Rollback()
+				return got == orig && btree.Equal(orig, buildTree(base))
+			},
+			gen.SliceOf(gen.IntRange(0, 2999)),
+			gen.SliceOf(gen.IntRange(0, 5999)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestRollback(t *testing.T) {
+	orig := buildTree([]int{1, 2, 3})
+	trans := orig.AsTransient()
+	trans.Add(4)
+	if got := trans.Rollback(); got != orig || got.Contains(4) {
+		t.Fatal("Rollback did not return the original tree")
+	}
+	if err := trans.TryAdd(5); !errors.Is(err, btree.ErrTafterP) {
+		t.Fatalf("got %v expected %v", err, btree.ErrTafterP)
+	}
+
+	other := orig.AsTransient().Savepoint()
+	defer func() {
+		if r := recover(); r != btree.ErrForeignSavepoint {
+			t.Fatalf("got %v expected %v", r, btree.ErrForeignSavepoint)
+		}
+	}()
+	orig.AsTransient().RollbackTo(other)
+}
+
+func TestPopMinMax(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("popping drains the tree from both ends in order",
+		prop.ForAll(
+			func(is []int, fromMax []bool) bool {
+				// Seed enough elements for pops to merge
+				// and borrow between internal nodes.
+				for i := 0; i < 500; i++ {
+					is = append(is, 7*i)
+				}
+				orig := buildTree(is)
+				want := slices.Collect(orig.All())
+				tree, trans := orig, orig.AsTransient()
+				lo, hi := 0, len(want)-1
+				for n := 0; lo <= hi; n++ {
+					top := n < len(fromMax) && fromMax[n]
+					var got, tgot int
+					var ok, tok bool
+					if top {
+						got, tree, ok = tree.PopMax()
+						tgot, tok = trans.PopMax()
+					} else {
+						got, tree, ok = tree.PopMin()
+						tgot, tok = trans.PopMin()
+					}
+					exp := want[lo]
+					if top {
+						exp = want[hi]
+						hi--
+					} else {
+						lo++
+					}
+					if !ok || !tok || got != exp || tgot != exp ||
+						tree.Length() != hi-lo+1 {
+						return false
+					}
+				}
+				_, empty, ok := tree.PopMin()
+				_, tok := trans.PopMax()
+				return !ok && !tok && empty == tree &&
+					trans.Length() == 0 &&
+					slices.Equal(slices.Collect(orig.All()), want)
+			},
+			gen.SliceOf(gen.Int()),
+			gen.SliceOf(gen.Bool()),
+		))
+	properties.TestingRun(t)
+}
+
+type tally struct {
+	key, count int
+}
+
+func TestAddUpdateFunc(t *testing.T) {
+	cmp := func(a, b tally) int { return compare(a.key, b.key) }
+	eq := func(a, b tally) bool { return a == b }
+	merge := func(old, new tally) tally {
+		return tally{old.key, old.count + new.count}
+	}
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("counts match a map after merging adds and updates",
+		prop.ForAll(
+			func(ops []int) bool {
+				// Seed enough keys for updates that delete
+				// to merge and borrow between nodes.
+				tree := btree.Empty(cmp, eq)
+				want := make(map[int]int)
+				for i := 0; i < 500; i++ {
+					tree = tree.Add(tally{3 * i, 1})
+					want[3*i] = 1
+				}
+				orig := tree
+				trans := tree.AsTransient()
+				for _, op := range ops {
+					key := (op / 4) % 1600
+					if op%4 < 2 {
+						tree = tree.AddFunc(tally{key, 2}, merge)
+						trans.AddFunc(tally{key, 2}, merge)
+						want[key] += 2
+						continue
+					}
+					update := func(old tally) (tally, bool) {
+						old.count--
+						return old, old.count > 0
+					}
+					tree = tree.UpdateFunc(tally{key: key}, update)
+					trans.UpdateFunc(tally{key: key}, update)
+					if want[key] > 1 {
+						want[key]--
+					} else {
+						delete(want, key)
+					}
+				}
+				got := make(map[int]int)
+				for e := range tree.All() {
+					got[e.key] = e.count
+				}
+				ttree := trans.AsPersistent()
+				tgot := make(map[int]int)
+				for e := range ttree.All() {
+					tgot[e.key] = e.count
+				}
+				return maps.Equal(got, want) && maps.Equal(tgot, want) &&
+					tree.Length() == len(want) &&
+					ttree.Length() == len(want) &&
+					orig.Length() == 500
+			},
+			gen.SliceOf(gen.IntRange(0, 6399)),
+		))
+	properties.TestingRun(t)
+
+	tree := btree.Empty(cmp, eq).Add(tally{1, 1})
+	if tree.UpdateFunc(tally{key: 2}, func(tally) (tally, bool) {
+		t.Fatal("update called for a missing key")
+		return tally{}, false
+	}) != tree {
+		t.Fatal("updating a missing key changed the tree")
+	}
+}
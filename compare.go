@@ -0,0 +1,203 @@
+package btree
+
+import (
+	"iter"
+)
+
+// Equal reports whether a and b contain the same elements in the
+// same order, using the equality function a was created with.
+func Equal[T any](a, b *BTree[T]) bool {
+	return EqualFunc(a, b, a.eq)
+}
+
+// EqualFunc reports whether a and b contain the same elements in the
+// same order, using eq to compare elements. Subtrees shared between
+// a and b are skipped without being visited.
+func EqualFunc[T any](a, b *BTree[T], eq func(x, y T) bool) bool {
+	if a.root == b.root {
+		return true
+	}
+	if a.count != b.count {
+		return false
+	}
+	ia, ib := a.Iterator(), b.Iterator()
+	for {
+		skipShared(&ia, &ib)
+		hasA, hasB := ia.HasNext(), ib.HasNext()
+		if !hasA || !hasB {
+			return hasA == hasB
+		}
+		if !eq(ia.Next(), ib.Next()) {
+			return false
+		}
+	}
+}
+
+// Compare compares a and b lexicographically using cmp. The result
+// is 0 if a == b, -1 if a < b, and +1 if a > b. A tree that is a
+// prefix of the other is the smaller one. Subtrees shared between a
+// and b are skipped without being visited.
+func Compare[T any](a, b *BTree[T], cmp func(x, y T) int) int {
+	if a.root == b.root {
+		return 0
+	}
+	ia, ib := a.Iterator(), b.Iterator()
+	for {
+		skipShared(&ia, &ib)
+		hasA, hasB := ia.HasNext(), ib.HasNext()
+		switch {
+		case !hasA && !hasB:
+			return 0
+		case !hasA:
+			return -1
+		case !hasB:
+			return 1
+		}
+		if c := cmp(ia.Next(), ib.Next()); c != 0 {
+			return max(-1, min(c, 1))
+		}
+	}
+}
+
+// Comparator returns the function used to order the elements of
+// the tree.
+func (t *BTree[T]) Comparator() func(a, b T) int {
+	return t.cmp
+}
+
+// Equality returns the function used to decide whether two elements
+// that compare equal are the same.
+func (t *BTree[T]) Equality() func(a, b T) bool {
+	return t.eq
+}
+
+// skipShared advances i and j past every subtree that both are about
+// to visit from the same position. What remains of such a subtree is
+// identical for both iterators.
+func skipShared[T any](i, j *Iterator[T]) {
+	for i.HasNext() && j.HasNext() && skipSharedOnce(i, j) {
+	}
+}
+
+// skipSharedOnce skips the largest shared subtree at the current
+// position, returning false if there is none.
+func skipSharedOnce[T any](i, j *Iterator[T]) bool {
+	off := j.depth - i.depth
+	from := max(max(i.startLevel(), j.startLevel()-off), -off)
+	for d := from; d <= i.depth; d++ {
+		si, sj := i.stack[d], j.stack[d+off]
+		if si.n == sj.n && si.cur == sj.cur {
+			i.exhaust(d)
+			j.exhaust(d + off)
+			return true
+		}
+	}
+	return false
+}
+
+// startLevel returns the smallest depth d such that the iterator is
+// positioned at the start of its current subtree at every level
+// below d.
+func (i *Iterator[T]) startLevel() int {
+	d := i.depth
+	for d > 0 {
+		state := i.stack[d]
+		switch {
+		case state.n.kind == nodeKindLeaf && state.cur != 0:
+			return d
+		case state.n.kind == nodeKindInternal && state.cur != 1:
+			return d
+		}
+		d--
+	}
+	return d
+}
+
+// exhaust moves the iterator past the remaining elements of the node
+// at depth d.
+func (i *Iterator[T]) exhaust(d int) {
+	for i.depth > d {
+		i.popNode()
+	}
+	i.stack[d].cur = i.stack[d].n.len
+}
+
+// ChangeKind describes how an element differs between two trees.
+type ChangeKind uint8
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Updated
+)
+
+var changeKindStrings = [...]string{
+	Added:   "added",
+	Removed: "removed",
+	Updated: "updated",
+}
+
+func (k ChangeKind) String() string {
+	return changeKindStrings[k]
+}
+
+// Change is a single difference between two trees. Old is set for
+// Removed and Updated changes and New for Added and Updated ones.
+type Change[T any] struct {
+	Kind ChangeKind
+	Old  T
+	New  T
+}
+
+// Diff allows one to range over the differences between old and
+// new in order. Elements that compare equal but are not equal
+// according to new's equality function are reported as Updated.
+// Subtrees shared between old and new are skipped without being
+// visited, so diffing two versions of a tree costs time proportional
+// to the size of the change.
+func Diff[T any](old, new *BTree[T]) iter.Seq[Change[T]] {
+	return func(yield func(Change[T]) bool) {
+		if old.root == new.root {
+			return
+		}
+		io, in := old.Iterator(), new.Iterator()
+		for {
+			skipShared(&io, &in)
+			hasOld, hasNew := io.HasNext(), in.HasNext()
+			var change Change[T]
+			switch {
+			case !hasOld && !hasNew:
+				return
+			case !hasNew:
+				change = Change[T]{Kind: Removed, Old: io.Next()}
+			case !hasOld:
+				change = Change[T]{Kind: Added, New: in.Next()}
+			default:
+				o, n := io.peek(), in.peek()
+				switch c := new.cmp(o, n); {
+				case c < 0:
+					change = Change[T]{Kind: Removed, Old: io.Next()}
+				case c > 0:
+					change = Change[T]{Kind: Added, New: in.Next()}
+				default:
+					io.Next()
+					in.Next()
+					if new.eq(o, n) {
+						continue
+					}
+					change = Change[T]{Kind: Updated, Old: o, New: n}
+				}
+			}
+			if !yield(change) {
+				return
+			}
+		}
+	}
+}
+
+// peek returns the element Next would return without advancing. It
+// must only be called after HasNext has returned true.
+func (i *Iterator[T]) peek() T {
+	state := i.stack[i.depth]
+	return state.n.keys[state.cur]
+}
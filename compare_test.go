@@ -0,0 +1,116 @@
+package btree_test
+
+import (
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+)
+
+func buildTree(is []int) *btree.BTree[int] {
+	t := btree.Empty(compare[int], eq[int]).AsTransient()
+	for _, i := range is {
+		t.Add(i)
+	}
+	return t.AsPersistent()
+}
+
+func TestEqual(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("a.Add(k).Delete(k) equals a", prop.ForAll(
+		func(is []int, k int) bool {
+			a := buildTree(is)
+			if a.Contains(k) {
+				return btree.Equal(a, a.Delete(k).Add(k))
+			}
+			return btree.Equal(a, a.Add(k).Delete(k))
+		},
+		gen.SliceOfN(5000, gen.Int()),
+		gen.Int(),
+	))
+	properties.Property("independently built trees are equal", prop.ForAll(
+		func(is []int) bool {
+			rev := make([]int, len(is))
+			for i, v := range is {
+				rev[len(is)-1-i] = v
+			}
+			return btree.Equal(buildTree(is), buildTree(rev))
+		},
+		gen.SliceOf(gen.Int()),
+	))
+	properties.Property("changing one element breaks equality", prop.ForAll(
+		func(is []int, k int) bool {
+			a := buildTree(is)
+			b := a.Delete(k)
+			if b == a {
+				b = a.Add(k)
+			}
+			return !btree.Equal(a, b) &&
+				btree.Compare(a, b, compare[int]) ==
+					-btree.Compare(b, a, compare[int]) &&
+				btree.Compare(a, b, compare[int]) != 0
+		},
+		gen.SliceOfN(5000, gen.IntRange(0, 10000)),
+		gen.IntRange(0, 10000),
+	))
+	properties.TestingRun(t)
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     []int
+		expected int
+	}{
+		{nil, nil, 0},
+		{nil, []int{1}, -1},
+		{[]int{1, 2}, []int{1}, 1},
+		{[]int{1, 2, 3}, []int{1, 2, 4}, -1},
+		{[]int{1, 5}, []int{1, 2, 4}, 1},
+	}
+	for _, test := range tests {
+		got := btree.Compare(buildTree(test.a), buildTree(test.b), compare[int])
+		if got != test.expected {
+			t.Fatalf("Compare(%v, %v) got %v expected %v",
+				test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("applying Diff(a, b) to a gives b", prop.ForAll(
+		func(is, adds, dels []int) bool {
+			a := btree.Empty(compareMapEntry, eqMapEntry).AsTransient()
+			for _, i := range is {
+				a.Add(mapEntry{key: i, val: i})
+			}
+			old := a.AsPersistent()
+			b := old.AsTransient()
+			for _, i := range adds {
+				b.Add(mapEntry{key: i, val: -i})
+			}
+			for _, i := range dels {
+				b.Delete(mapEntry{key: i})
+			}
+			new := b.AsPersistent()
+			patched := old.AsTransient()
+			for c := range btree.Diff(old, new) {
+				switch c.Kind {
+				case btree.Added, btree.Updated:
+					patched.Add(c.New)
+				case btree.Removed:
+					patched.Delete(c.Old)
+				}
+			}
+			return btree.Equal(patched.AsPersistent(), new)
+		},
+		gen.SliceOfN(3000, gen.IntRange(0, 5000)),
+		gen.SliceOf(gen.IntRange(0, 5000)),
+		gen.SliceOf(gen.IntRange(0, 5000)),
+	))
+	properties.TestingRun(t)
+}
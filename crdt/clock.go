@@ -0,0 +1,122 @@
+// Package crdt implements conflict-free replicated data types on top
+// of the persistent maps and sets of this module. Replicas may be
+// updated independently and merged in any order and any number of
+// times; once every replica has seen the same updates they hold the
+// same value.
+package crdt
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Timestamp is a hybrid logical clock reading. Wall is a physical time
+// in nanoseconds, Logical orders events sharing a wall time and Node
+// identifies the replica so that timestamps from different replicas
+// never compare equal.
+type Timestamp struct {
+	Wall    int64
+	Logical uint32
+	Node    string
+}
+
+// Compare orders timestamps by wall time, then logical time, then
+// node.
+func (t Timestamp) Compare(o Timestamp) int {
+	if c := cmp.Compare(t.Wall, o.Wall); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(t.Logical, o.Logical); c != 0 {
+		return c
+	}
+	return strings.Compare(t.Node, o.Node)
+}
+
+func (t Timestamp) IsZero() bool {
+	return t == Timestamp{}
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%d.%d@%s", t.Wall, t.Logical, t.Node)
+}
+
+// Clock issues hybrid logical clock timestamps for one replica. Every
+// timestamp it issues is greater than any it issued or observed
+// before, even if the physical clock goes backwards.
+type Clock struct {
+	mu   sync.Mutex
+	node string
+	now  func() time.Time
+	last Timestamp
+}
+
+// NewClock returns a clock for the replica node using the system
+// clock.
+func NewClock(node string) *Clock {
+	return NewClockFunc(node, time.Now)
+}
+
+// NewClockFunc returns a clock for the replica node that reads the
+// physical time from now.
+func NewClockFunc(node string, now func() time.Time) *Clock {
+	return &Clock{node: node, now: now}
+}
+
+// Now returns a new timestamp for a local event.
+func (c *Clock) Now() Timestamp {
+	return c.Update(Timestamp{})
+}
+
+// Update returns a new timestamp for the receipt of an event stamped
+// remote, which is then ordered after the event.
+func (c *Clock) Update(remote Timestamp) Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wall := max(c.now().UnixNano(), c.last.Wall, remote.Wall)
+	var logical uint32
+	switch {
+	case wall == c.last.Wall && wall == remote.Wall:
+		logical = max(c.last.Logical, remote.Logical) + 1
+	case wall == c.last.Wall:
+		logical = c.last.Logical + 1
+	case wall == remote.Wall:
+		logical = remote.Logical + 1
+	}
+	c.last = Timestamp{Wall: wall, Logical: logical, Node: c.node}
+	return c.last
+}
+
+// event is an entry of the time index kept by each type, which allows
+// deltas and garbage collection to visit only the entries they need.
+// bound is set to 1 by probes that sort after every event with their
+// timestamp.
+type event[K any] struct {
+	ts    Timestamp
+	key   K
+	bound int8
+}
+
+func emptyIndex[K any](cmp func(a, b K) int) *btree.BTree[event[K]] {
+	compare := func(a, b event[K]) int {
+		if c := a.ts.Compare(b.ts); c != 0 {
+			return c
+		}
+		if a.bound != 0 || b.bound != 0 {
+			return int(a.bound) - int(b.bound)
+		}
+		return cmp(a.key, b.key)
+	}
+	return btree.Empty(compare, func(a, b event[K]) bool {
+		return compare(a, b) == 0
+	})
+}
+
+// after returns a probe sorting after every event at or before ts.
+func after[K any](ts Timestamp) event[K] {
+	return event[K]{ts: ts, bound: 1}
+}
@@ -0,0 +1,264 @@
+package crdt_test
+
+import (
+	"cmp"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree/crdt"
+)
+
+// op is a generated update. Replica picks which of three replicas it
+// is applied to and Delete picks a delete instead of a write.
+type op struct {
+	Replica int
+	Key     int
+	Delete  bool
+}
+
+func genOps() gopter.Gen {
+	return gen.SliceOf(gen.Struct(reflect.TypeOf(op{}), map[string]gopter.Gen{
+		"Replica": gen.IntRange(0, 2),
+		"Key":     gen.IntRange(0, 20),
+		"Delete":  gen.Bool(),
+	}))
+}
+
+func newClocks() []*crdt.Clock {
+	return []*crdt.Clock{
+		crdt.NewClockFunc("a", fixedTime),
+		crdt.NewClockFunc("b", fixedTime),
+		crdt.NewClockFunc("c", fixedTime),
+	}
+}
+
+// replayLWW applies ops to three LWW replicas, each with its own
+// clock. Every write gets a distinct value so that conflicting writes
+// can be told apart.
+func replayLWW(replicas []*crdt.LWWMap[int, int], clocks []*crdt.Clock,
+	ops []op) []*crdt.LWWMap[int, int] {
+	if replicas == nil {
+		for range clocks {
+			replicas = append(replicas,
+				crdt.NewLWWMap[int, int](cmp.Compare[int]))
+		}
+	}
+	replicas = slices.Clone(replicas)
+	for n, o := range ops {
+		r := replicas[o.Replica]
+		ts := clocks[o.Replica].Now()
+		if o.Delete {
+			replicas[o.Replica] = r.Delete(o.Key, ts)
+		} else {
+			replicas[o.Replica] = r.Set(o.Key, n, ts)
+		}
+	}
+	return replicas
+}
+
+func replayORSet(replicas []*crdt.ORSet[int], clocks []*crdt.Clock,
+	ops []op) []*crdt.ORSet[int] {
+	if replicas == nil {
+		for range clocks {
+			replicas = append(replicas, crdt.NewORSet(cmp.Compare[int]))
+		}
+	}
+	replicas = slices.Clone(replicas)
+	for _, o := range ops {
+		r := replicas[o.Replica]
+		ts := clocks[o.Replica].Now()
+		if o.Delete {
+			replicas[o.Replica] = r.Remove(o.Key, ts)
+		} else {
+			replicas[o.Replica] = r.Add(o.Key, ts)
+		}
+	}
+	return replicas
+}
+
+func fixedTime() time.Time {
+	return time.Unix(0, 0)
+}
+
+func lwwEqual(a, b *crdt.LWWMap[int, int]) bool {
+	return a.Len() == b.Len() &&
+		maps.Equal(maps.Collect(a.All()), maps.Collect(b.All())) &&
+		a.Version() == b.Version()
+}
+
+func orsetEqual(a, b *crdt.ORSet[int]) bool {
+	return slices.Equal(slices.Collect(a.All()), slices.Collect(b.All())) &&
+		a.Version() == b.Version()
+}
+
+func TestLWWMapMerge(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Merge is commutative",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayLWW(nil, newClocks(), ops)
+				return lwwEqual(r[0].Merge(r[1]), r[1].Merge(r[0]))
+			},
+			genOps(),
+		))
+	properties.Property("Merge is associative",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayLWW(nil, newClocks(), ops)
+				return lwwEqual(r[0].Merge(r[1]).Merge(r[2]),
+					r[0].Merge(r[1].Merge(r[2])))
+			},
+			genOps(),
+		))
+	properties.Property("Merge is idempotent",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayLWW(nil, newClocks(), ops)
+				m := r[0].Merge(r[1])
+				return m.Merge(r[1]) == m && lwwEqual(m.Merge(m), m)
+			},
+			genOps(),
+		))
+	properties.Property("Delta brings a replica up to date",
+		prop.ForAll(
+			func(before, after []op) bool {
+				clocks := newClocks()
+				r := replayLWW(nil, clocks, before)
+				synced := r[0].Merge(r[1])
+				since := synced.Version()
+				for _, c := range clocks {
+					c.Update(since)
+				}
+				later := replayLWW(r, clocks, after)
+				updated := later[0].Merge(later[1])
+				delta := updated.Delta(since)
+				return lwwEqual(synced.Merge(delta), updated)
+			},
+			genOps(), genOps(),
+		))
+	properties.TestingRun(t)
+}
+
+func TestLWWMapGC(t *testing.T) {
+	clock := crdt.NewClockFunc("a", fixedTime)
+	m := crdt.NewLWWMap[string, int](cmp.Compare[string])
+	m = m.Set("a", 1, clock.Now())
+	m = m.Set("b", 2, clock.Now())
+	old := clock.Now()
+	stale := m.Set("b", 3, old)
+	m = m.Delete("b", clock.Now())
+	cut := clock.Now()
+	m = m.Delete("a", clock.Now())
+	if m.Len() != 0 || m.Contains("b") {
+		t.Fatalf("got %v live keys expected 0", m.Len())
+	}
+	if got := m.Merge(stale); got.Contains("b") {
+		t.Fatal("tombstone lost to an older write")
+	}
+	gc := m.GC(cut)
+	if gc.Delta(crdt.Timestamp{}).Len() != 0 {
+		t.Fatal("delta after GC holds live keys")
+	}
+	if got := gc.Merge(stale); !got.Contains("b") {
+		t.Fatal("expected the tombstone of b to be collected")
+	}
+	if got := gc.Merge(m.Set("a", 4, old)); got.Contains("a") {
+		t.Fatal("expected the tombstone of a to survive GC")
+	}
+}
+
+func TestORSetMerge(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("Merge is commutative",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayORSet(nil, newClocks(), ops)
+				return orsetEqual(r[0].Merge(r[1]), r[1].Merge(r[0]))
+			},
+			genOps(),
+		))
+	properties.Property("Merge is associative",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayORSet(nil, newClocks(), ops)
+				return orsetEqual(r[0].Merge(r[1]).Merge(r[2]),
+					r[0].Merge(r[1].Merge(r[2])))
+			},
+			genOps(),
+		))
+	properties.Property("Merge is idempotent",
+		prop.ForAll(
+			func(ops []op) bool {
+				r := replayORSet(nil, newClocks(), ops)
+				m := r[0].Merge(r[1])
+				return m.Merge(r[1]) == m && orsetEqual(m.Merge(m), m)
+			},
+			genOps(),
+		))
+	properties.Property("Delta brings a replica up to date",
+		prop.ForAll(
+			func(before, after []op) bool {
+				clocks := newClocks()
+				r := replayORSet(nil, clocks, before)
+				synced := r[0].Merge(r[1])
+				since := synced.Version()
+				for _, c := range clocks {
+					c.Update(since)
+				}
+				later := replayORSet(r, clocks, after)
+				updated := later[0].Merge(later[1])
+				return orsetEqual(synced.Merge(updated.Delta(since)),
+					updated)
+			},
+			genOps(), genOps(),
+		))
+	properties.TestingRun(t)
+}
+
+func TestORSetAddWins(t *testing.T) {
+	a := crdt.NewClockFunc("a", fixedTime)
+	b := crdt.NewClockFunc("b", fixedTime)
+	s := crdt.NewORSet(cmp.Compare[string]).Add("x", a.Now())
+	removed := s.Remove("x", a.Now())
+	added := s.Add("x", b.Now())
+	if removed.Contains("x") {
+		t.Fatal("expected x to be removed")
+	}
+	merged := removed.Merge(added)
+	if !merged.Contains("x") || merged.Len() != 1 {
+		t.Fatal("expected the concurrent add to win")
+	}
+	merged = merged.Remove("x", a.Now())
+	if merged.Contains("x") || merged.Len() != 0 {
+		t.Fatal("expected x to be removed")
+	}
+	if got := merged.GC(a.Now()).Merge(added); !got.Contains("x") {
+		t.Fatal("expected the tombstones of x to be collected")
+	}
+}
+
+func TestClock(t *testing.T) {
+	now := time.Unix(10, 0)
+	c := crdt.NewClockFunc("a", func() time.Time { return now })
+	first := c.Now()
+	second := c.Now()
+	if second.Compare(first) <= 0 {
+		t.Fatalf("got %v after %v", second, first)
+	}
+	now = time.Unix(5, 0)
+	if ts := c.Now(); ts.Compare(second) <= 0 {
+		t.Fatalf("clock went backwards: %v after %v", ts, second)
+	}
+	remote := crdt.Timestamp{Wall: time.Unix(20, 0).UnixNano(), Logical: 7, Node: "b"}
+	if ts := c.Update(remote); ts.Compare(remote) <= 0 || ts.Node != "a" {
+		t.Fatalf("got %v after receiving %v", ts, remote)
+	}
+}
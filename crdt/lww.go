@@ -0,0 +1,194 @@
+package crdt
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+)
+
+// LWWMap is a persistent map whose keys are last-writer-wins
+// registers. Every write carries a timestamp and the write with the
+// greatest timestamp wins, whichever order writes are applied in.
+// Deletes are kept as tombstones so that they win over older writes
+// arriving later; GC discards them once every replica has seen them.
+type LWWMap[K, V any] struct {
+	regs   *treemap.Map[K, register[V]]
+	byTime *btree.BTree[event[K]]
+	live   int
+}
+
+// register is the latest write to a key. A tombstone records a delete.
+type register[V any] struct {
+	value     V
+	ts        Timestamp
+	tombstone bool
+}
+
+// supersedes reports whether r wins over old. Writes with the same
+// timestamp are the same write, except that a tombstone wins so the
+// outcome does not depend on the order they are applied in.
+func (r register[V]) supersedes(old register[V]) bool {
+	c := r.ts.Compare(old.ts)
+	return c > 0 || c == 0 && r.tombstone && !old.tombstone
+}
+
+// NewLWWMap returns an empty map whose keys are ordered by cmp.
+func NewLWWMap[K, V any](cmp func(a, b K) int) *LWWMap[K, V] {
+	return &LWWMap[K, V]{
+		regs: treemap.Empty[K, register[V]](cmp,
+			func(a, b register[V]) bool {
+				return a.ts == b.ts && a.tombstone == b.tombstone
+			}),
+		byTime: emptyIndex(cmp),
+	}
+}
+
+func (m *LWWMap[K, V]) Contains(key K) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+// Get returns the value of key. The boolean is false if the key was
+// never written or its latest write is a delete.
+func (m *LWWMap[K, V]) Get(key K) (V, bool) {
+	r, ok := m.regs.Find(key)
+	if !ok || r.tombstone {
+		var zero V
+		return zero, false
+	}
+	return r.value, true
+}
+
+// Len returns the number of keys that are not deleted.
+func (m *LWWMap[K, V]) Len() int {
+	return m.live
+}
+
+// All allows one to range over the keys that are not deleted, in
+// order.
+func (m *LWWMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, r := range m.regs.All() {
+			if !r.tombstone && !yield(key, r.value) {
+				return
+			}
+		}
+	}
+}
+
+// Version returns the greatest timestamp of the writes in the map, or
+// the zero timestamp if it is empty.
+func (m *LWWMap[K, V]) Version() Timestamp {
+	e, _ := m.byTime.Max()
+	return e.ts
+}
+
+// Set returns a map where key holds value as of ts. The map is
+// returned unchanged if key was already written at or after ts.
+func (m *LWWMap[K, V]) Set(key K, value V, ts Timestamp) *LWWMap[K, V] {
+	return m.update(func(t *lwwTxn[K, V]) {
+		t.put(key, register[V]{value: value, ts: ts})
+	})
+}
+
+// Delete returns a map where key is deleted as of ts. The map is
+// returned unchanged if key was already written at or after ts.
+func (m *LWWMap[K, V]) Delete(key K, ts Timestamp) *LWWMap[K, V] {
+	return m.update(func(t *lwwTxn[K, V]) {
+		t.put(key, register[V]{ts: ts, tombstone: true})
+	})
+}
+
+// Merge returns the map holding the latest write to every key of m and
+// other. Merge is commutative, associative and idempotent.
+func (m *LWWMap[K, V]) Merge(other *LWWMap[K, V]) *LWWMap[K, V] {
+	// Apply the smaller map to the larger one.
+	if other.byTime.Length() > m.byTime.Length() {
+		m, other = other, m
+	}
+	return m.update(func(t *lwwTxn[K, V]) {
+		for key, r := range other.regs.All() {
+			t.put(key, r)
+		}
+	})
+}
+
+// Delta returns a map holding the writes, including deletes, made
+// after since. Merging it into a replica that has seen every write up
+// to since brings that replica up to date with m. Deltas are found
+// through an index by time and cost O(log n) plus their size.
+func (m *LWWMap[K, V]) Delta(since Timestamp) *LWWMap[K, V] {
+	out := NewLWWMap[K, V](m.regs.Comparator())
+	return out.update(func(t *lwwTxn[K, V]) {
+		i := m.byTime.IteratorFrom(after[K](since))
+		for i.HasNext() {
+			key := i.Next().key
+			t.put(key, m.regs.At(key))
+		}
+	})
+}
+
+// GC returns a map without the tombstones of deletes made before
+// before. It must only be called once every replica has seen those
+// deletes, otherwise an older write may reappear when merged.
+func (m *LWWMap[K, V]) GC(before Timestamp) *LWWMap[K, V] {
+	return m.update(func(t *lwwTxn[K, V]) {
+		i := m.byTime.Iterator()
+		for i.HasNext() {
+			e := i.Next()
+			if e.ts.Compare(before) >= 0 {
+				return
+			}
+			if m.regs.At(e.key).tombstone {
+				t.regs.Delete(e.key)
+				t.byTime.Delete(e)
+			}
+		}
+	})
+}
+
+// update applies fn to a transient copy of m and returns the result,
+// or m itself if nothing changed.
+func (m *LWWMap[K, V]) update(fn func(t *lwwTxn[K, V])) *LWWMap[K, V] {
+	t := &lwwTxn[K, V]{
+		regs:   m.regs.AsTransient(),
+		byTime: m.byTime.AsTransient(),
+		live:   m.live,
+	}
+	fn(t)
+	regs := t.regs.AsPersistent()
+	if regs == m.regs {
+		t.byTime.AsPersistent()
+		return m
+	}
+	return &LWWMap[K, V]{
+		regs:   regs,
+		byTime: t.byTime.AsPersistent(),
+		live:   t.live,
+	}
+}
+
+type lwwTxn[K, V any] struct {
+	regs   *treemap.TMap[K, register[V]]
+	byTime *btree.TBTree[event[K]]
+	live   int
+}
+
+func (t *lwwTxn[K, V]) put(key K, r register[V]) {
+	old, ok := t.regs.Find(key)
+	if ok && !r.supersedes(old) {
+		return
+	}
+	if ok {
+		t.byTime.Delete(event[K]{ts: old.ts, key: key})
+		if !old.tombstone {
+			t.live--
+		}
+	}
+	t.regs.Assoc(key, r)
+	t.byTime.Add(event[K]{ts: r.ts, key: key})
+	if !r.tombstone {
+		t.live++
+	}
+}
@@ -0,0 +1,218 @@
+package crdt
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+	"jsouthworth.net/go/btree/treeset"
+)
+
+// ORSet is a persistent observed-remove set. Every add of an element
+// is tagged with its timestamp and a remove only removes the tags it
+// has observed, so an add concurrent with a remove wins. Removed tags
+// are kept as tombstones until GC discards them.
+type ORSet[T any] struct {
+	adds   *treeset.Set[tag[T]]
+	tombs  *treemap.Map[tag[T], Timestamp]
+	byTime *btree.BTree[event[tag[T]]]
+	cmp    func(a, b T) int
+}
+
+// tag identifies one add of elem. bound is set to -1 by probes that
+// sort before every tag of their element.
+type tag[T any] struct {
+	elem  T
+	ts    Timestamp
+	bound int8
+}
+
+// NewORSet returns an empty set whose elements are ordered by cmp.
+func NewORSet[T any](cmp func(a, b T) int) *ORSet[T] {
+	tcmp := func(a, b tag[T]) int {
+		if c := cmp(a.elem, b.elem); c != 0 {
+			return c
+		}
+		if a.bound != 0 || b.bound != 0 {
+			return int(a.bound) - int(b.bound)
+		}
+		return a.ts.Compare(b.ts)
+	}
+	return &ORSet[T]{
+		adds: treeset.Empty(tcmp),
+		tombs: treemap.Empty[tag[T], Timestamp](tcmp,
+			func(a, b Timestamp) bool {
+				return a == b
+			}),
+		byTime: emptyIndex(tcmp),
+		cmp:    cmp,
+	}
+}
+
+func (s *ORSet[T]) Contains(elem T) bool {
+	i := s.adds.IteratorFrom(tag[T]{elem: elem, bound: -1})
+	return i.HasNext() && s.cmp(i.Next().elem, elem) == 0
+}
+
+// Len returns the number of elements in the set. It counts them so it
+// costs O(n).
+func (s *ORSet[T]) Len() int {
+	var n int
+	for range s.All() {
+		n++
+	}
+	return n
+}
+
+// All allows one to range over the elements of the set in order.
+func (s *ORSet[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		first := true
+		var prev T
+		for t := range s.adds.All() {
+			if !first && s.cmp(t.elem, prev) == 0 {
+				continue
+			}
+			if !yield(t.elem) {
+				return
+			}
+			first, prev = false, t.elem
+		}
+	}
+}
+
+// Version returns the greatest timestamp of the adds and removes in
+// the set, or the zero timestamp if there are none.
+func (s *ORSet[T]) Version() Timestamp {
+	e, _ := s.byTime.Max()
+	return e.ts
+}
+
+// Add returns a set that contains elem, tagged with ts.
+func (s *ORSet[T]) Add(elem T, ts Timestamp) *ORSet[T] {
+	return s.update(func(t *orsetTxn[T]) {
+		t.add(tag[T]{elem: elem, ts: ts})
+	})
+}
+
+// Remove returns a set without elem, tombstoning every tag of elem in
+// s as of ts. Adds of elem that s has not seen are not affected.
+func (s *ORSet[T]) Remove(elem T, ts Timestamp) *ORSet[T] {
+	return s.update(func(t *orsetTxn[T]) {
+		i := s.adds.IteratorFrom(tag[T]{elem: elem, bound: -1})
+		for i.HasNext() {
+			tg := i.Next()
+			if s.cmp(tg.elem, elem) != 0 {
+				return
+			}
+			t.remove(tg, ts)
+		}
+	})
+}
+
+// Merge returns the set holding the adds and removes of both s and
+// other. Merge is commutative, associative and idempotent.
+func (s *ORSet[T]) Merge(other *ORSet[T]) *ORSet[T] {
+	// Apply the smaller set to the larger one.
+	if other.byTime.Length() > s.byTime.Length() {
+		s, other = other, s
+	}
+	return s.update(func(t *orsetTxn[T]) {
+		for tg, ts := range other.tombs.All() {
+			t.remove(tg, ts)
+		}
+		for tg := range other.adds.All() {
+			t.add(tg)
+		}
+	})
+}
+
+// Delta returns a set holding the adds and removes made after since.
+// See (*LWWMap[K, V]).Delta.
+func (s *ORSet[T]) Delta(since Timestamp) *ORSet[T] {
+	out := NewORSet(s.cmp)
+	return out.update(func(t *orsetTxn[T]) {
+		i := s.byTime.IteratorFrom(after[tag[T]](since))
+		for i.HasNext() {
+			e := i.Next()
+			if ts, ok := s.tombs.Find(e.key); ok {
+				t.remove(e.key, ts)
+			} else {
+				t.add(e.key)
+			}
+		}
+	})
+}
+
+// GC returns a set without the tombstones of removes made before
+// before. It must only be called once every replica has seen those
+// removes, otherwise a removed add may reappear when merged.
+func (s *ORSet[T]) GC(before Timestamp) *ORSet[T] {
+	return s.update(func(t *orsetTxn[T]) {
+		i := s.byTime.Iterator()
+		for i.HasNext() {
+			e := i.Next()
+			if e.ts.Compare(before) >= 0 {
+				return
+			}
+			if s.tombs.Contains(e.key) {
+				t.tombs.Delete(e.key)
+				t.byTime.Delete(e)
+			}
+		}
+	})
+}
+
+// update applies fn to a transient copy of s and returns the result,
+// or s itself if nothing changed.
+func (s *ORSet[T]) update(fn func(t *orsetTxn[T])) *ORSet[T] {
+	t := &orsetTxn[T]{
+		adds:   s.adds.AsTransient(),
+		tombs:  s.tombs.AsTransient(),
+		byTime: s.byTime.AsTransient(),
+	}
+	fn(t)
+	out := &ORSet[T]{
+		adds:   t.adds.AsPersistent(),
+		tombs:  t.tombs.AsPersistent(),
+		byTime: t.byTime.AsPersistent(),
+		cmp:    s.cmp,
+	}
+	if out.byTime == s.byTime {
+		return s
+	}
+	return out
+}
+
+// orsetTxn applies changes to an ORSet. A tag is either in adds or in
+// tombs, and byTime holds an event for it at the time it was added or
+// removed respectively.
+type orsetTxn[T any] struct {
+	adds   *treeset.TSet[tag[T]]
+	tombs  *treemap.TMap[tag[T], Timestamp]
+	byTime *btree.TBTree[event[tag[T]]]
+}
+
+func (t *orsetTxn[T]) add(tg tag[T]) {
+	if t.tombs.Contains(tg) || t.adds.Contains(tg) {
+		return
+	}
+	t.adds.Add(tg)
+	t.byTime.Add(event[tag[T]]{ts: tg.ts, key: tg})
+}
+
+// remove tombstones tg as of ts. If tg was already removed the later
+// of the two removes is kept so replicas agree on when it happened.
+func (t *orsetTxn[T]) remove(tg tag[T], ts Timestamp) {
+	if old, ok := t.tombs.Find(tg); ok {
+		if old.Compare(ts) >= 0 {
+			return
+		}
+		t.byTime.Delete(event[tag[T]]{ts: old, key: tg})
+	} else if t.adds.Contains(tg) {
+		t.adds.Remove(tg)
+		t.byTime.Delete(event[tag[T]]{ts: tg.ts, key: tg})
+	}
+	t.tombs.Assoc(tg, ts)
+	t.byTime.Add(event[tag[T]]{ts: ts, key: tg})
+}
@@ -0,0 +1,287 @@
+package indexed
+
+import (
+	"fmt"
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Index describes a secondary index of records of type R. Indexes are
+// created with NewIndex or NewUniqueIndex and passed to New. The same
+// Index is then used to query the tables it was passed to.
+type Index[R any] interface {
+	build(pkcmp func(a, b R) int) secondary[R]
+}
+
+// KeyIndex orders records by a key of type K extracted from each
+// record. Records with equal keys are ordered by primary key.
+type KeyIndex[R, K any] struct {
+	name   string
+	key    func(R) K
+	cmp    func(a, b K) int
+	unique bool
+}
+
+// NewIndex returns an index ordering records by key using cmp. Any
+// number of records may share a key.
+func NewIndex[R, K any](name string, key func(R) K, cmp func(a, b K) int) *KeyIndex[R, K] {
+	return &KeyIndex[R, K]{
+		name: name,
+		key:  key,
+		cmp:  cmp,
+	}
+}
+
+// NewUniqueIndex returns an index ordering records by key using cmp.
+// Changes that would give two records the same key fail with
+// ErrDuplicate.
+func NewUniqueIndex[R, K any](name string, key func(R) K, cmp func(a, b K) int) *KeyIndex[R, K] {
+	idx := NewIndex(name, key, cmp)
+	idx.unique = true
+	return idx
+}
+
+func (idx *KeyIndex[R, K]) Name() string {
+	return idx.name
+}
+
+func (idx *KeyIndex[R, K]) Unique() bool {
+	return idx.unique
+}
+
+func (idx *KeyIndex[R, K]) build(pkcmp func(a, b R) int) secondary[R] {
+	cmp := func(a, b ientry[R, K]) int {
+		if c := idx.cmp(a.key, b.key); c != 0 {
+			return c
+		}
+		if a.bound != 0 || b.bound != 0 {
+			return int(a.bound) - int(b.bound)
+		}
+		return pkcmp(a.rec, b.rec)
+	}
+	return &indexTree[R, K]{
+		idx: idx,
+		impl: btree.Empty(
+			cmp,
+			func(a, b ientry[R, K]) bool {
+				return false
+			},
+		),
+		pkcmp: pkcmp,
+	}
+}
+
+// ientry is an element of an index. bound is set to -1 by probes
+// that sort before every record with their key.
+type ientry[R, K any] struct {
+	key   K
+	rec   R
+	bound int8
+}
+
+func (idx *KeyIndex[R, K]) entry(rec R) ientry[R, K] {
+	return ientry[R, K]{key: idx.key(rec), rec: rec}
+}
+
+func lowerBound[R, K any](key K) ientry[R, K] {
+	return ientry[R, K]{key: key, bound: -1}
+}
+
+// check returns ErrDuplicate if rec has the key of a record with a
+// different primary key in a unique index.
+func (idx *KeyIndex[R, K]) check(
+	i btree.Iterator[ientry[R, K]],
+	pkcmp func(a, b R) int,
+	rec R,
+) error {
+	if !idx.unique || !i.HasNext() {
+		return nil
+	}
+	e := i.Next()
+	if idx.cmp(e.key, idx.key(rec)) != 0 || pkcmp(e.rec, rec) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %v", ErrDuplicate, idx.name, e.key)
+}
+
+type secondary[R any] interface {
+	def() any
+	check(rec R) error
+	add(rec R) secondary[R]
+	remove(rec R) secondary[R]
+	asTransient() tsecondary[R]
+}
+
+type tsecondary[R any] interface {
+	def() any
+	check(rec R) error
+	add(rec R)
+	remove(rec R)
+	asPersistent() secondary[R]
+}
+
+type indexTree[R, K any] struct {
+	idx   *KeyIndex[R, K]
+	impl  *btree.BTree[ientry[R, K]]
+	pkcmp func(a, b R) int
+}
+
+func (t *indexTree[R, K]) def() any {
+	return t.idx
+}
+
+func (t *indexTree[R, K]) check(rec R) error {
+	return t.idx.check(t.iteratorFrom(lowerBound[R](t.idx.key(rec))),
+		t.pkcmp, rec)
+}
+
+func (t *indexTree[R, K]) add(rec R) secondary[R] {
+	return &indexTree[R, K]{
+		idx:   t.idx,
+		impl:  t.impl.Add(t.idx.entry(rec)),
+		pkcmp: t.pkcmp,
+	}
+}
+
+func (t *indexTree[R, K]) remove(rec R) secondary[R] {
+	return &indexTree[R, K]{
+		idx:   t.idx,
+		impl:  t.impl.Delete(t.idx.entry(rec)),
+		pkcmp: t.pkcmp,
+	}
+}
+
+func (t *indexTree[R, K]) asTransient() tsecondary[R] {
+	return &tindexTree[R, K]{
+		idx:   t.idx,
+		impl:  t.impl.AsTransient(),
+		pkcmp: t.pkcmp,
+	}
+}
+
+func (t *indexTree[R, K]) iterator() btree.Iterator[ientry[R, K]] {
+	return t.impl.Iterator()
+}
+
+func (t *indexTree[R, K]) iteratorFrom(e ientry[R, K]) btree.Iterator[ientry[R, K]] {
+	return t.impl.IteratorFrom(e)
+}
+
+type tindexTree[R, K any] struct {
+	idx   *KeyIndex[R, K]
+	impl  *btree.TBTree[ientry[R, K]]
+	pkcmp func(a, b R) int
+}
+
+func (t *tindexTree[R, K]) def() any {
+	return t.idx
+}
+
+func (t *tindexTree[R, K]) check(rec R) error {
+	return t.idx.check(t.iteratorFrom(lowerBound[R](t.idx.key(rec))),
+		t.pkcmp, rec)
+}
+
+func (t *tindexTree[R, K]) add(rec R) {
+	t.impl.Add(t.idx.entry(rec))
+}
+
+func (t *tindexTree[R, K]) remove(rec R) {
+	t.impl.Delete(t.idx.entry(rec))
+}
+
+func (t *tindexTree[R, K]) asPersistent() secondary[R] {
+	return &indexTree[R, K]{
+		idx:   t.idx,
+		impl:  t.impl.AsPersistent(),
+		pkcmp: t.pkcmp,
+	}
+}
+
+func (t *tindexTree[R, K]) iterator() btree.Iterator[ientry[R, K]] {
+	return t.impl.Iterator()
+}
+
+func (t *tindexTree[R, K]) iteratorFrom(e ientry[R, K]) btree.Iterator[ientry[R, K]] {
+	return t.impl.IteratorFrom(e)
+}
+
+// Source is implemented by Table and TTable and allows either to be
+// queried through its indexes.
+type Source[R any] interface {
+	index(def any) any
+}
+
+type indexReader[R, K any] interface {
+	iterator() btree.Iterator[ientry[R, K]]
+	iteratorFrom(e ientry[R, K]) btree.Iterator[ientry[R, K]]
+}
+
+func reader[R, K any](src Source[R], idx *KeyIndex[R, K]) indexReader[R, K] {
+	return src.index(idx).(indexReader[R, K])
+}
+
+// Get returns the first record with the given key in idx. It is most
+// useful with unique indexes. Get panics with ErrUnknownIndex if src
+// does not maintain idx.
+func Get[R, K any](src Source[R], idx *KeyIndex[R, K], key K) (R, bool) {
+	for rec := range Lookup(src, idx, key) {
+		return rec, true
+	}
+	var zero R
+	return zero, false
+}
+
+// Lookup allows one to range over the records with the given key in
+// idx, in primary key order.
+func Lookup[R, K any](src Source[R], idx *KeyIndex[R, K], key K) iter.Seq[R] {
+	return scan(reader(src, idx), key, func(k K) bool {
+		return idx.cmp(k, key) == 0
+	})
+}
+
+// Range allows one to range over the records whose key in idx is at
+// least lo and below hi, in index order.
+func Range[R, K any](src Source[R], idx *KeyIndex[R, K], lo, hi K) iter.Seq[R] {
+	return scan(reader(src, idx), lo, func(k K) bool {
+		return idx.cmp(k, hi) < 0
+	})
+}
+
+// From allows one to range over the records whose key in idx is at
+// least from, in index order.
+func From[R, K any](src Source[R], idx *KeyIndex[R, K], from K) iter.Seq[R] {
+	return scan(reader(src, idx), from, func(K) bool {
+		return true
+	})
+}
+
+// Ascend allows one to range over every record in index order.
+func Ascend[R, K any](src Source[R], idx *KeyIndex[R, K]) iter.Seq[R] {
+	r := reader(src, idx)
+	return func(yield func(R) bool) {
+		i := r.iterator()
+		for i.HasNext() {
+			if !yield(i.Next().rec) {
+				return
+			}
+		}
+	}
+}
+
+func scan[R, K any](
+	r indexReader[R, K],
+	from K,
+	in func(K) bool,
+) iter.Seq[R] {
+	return func(yield func(R) bool) {
+		i := r.iteratorFrom(lowerBound[R](from))
+		for i.HasNext() {
+			e := i.Next()
+			if !in(e.key) || !yield(e.rec) {
+				return
+			}
+		}
+	}
+}
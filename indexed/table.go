@@ -0,0 +1,362 @@
+// Package indexed implements a persistent in-memory table of records
+// identified by a primary key and kept in any number of secondary
+// indexes. Every change to a table updates all of its indexes at
+// once, either producing a new table or failing without effect.
+package indexed
+
+import (
+	"fmt"
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+const (
+	// ErrExists is returned when inserting a record whose primary
+	// key is already present.
+	ErrExists = Error("record already exists")
+	// ErrNotFound is returned when updating a record whose primary
+	// key is not present.
+	ErrNotFound = Error("record not found")
+	// ErrDuplicate is returned when a change would give two records
+	// the same key in a unique index.
+	ErrDuplicate = Error("duplicate key in unique index")
+	// ErrUnknownIndex is the panic value when querying a table with
+	// an index it was not created with.
+	ErrUnknownIndex = Error("index is not part of the table")
+)
+
+type row[K, R any] struct {
+	key K
+	rec R
+}
+
+// Table is a persistent set of records of type R with primary keys of
+// type K.
+type Table[K, R any] struct {
+	primary *btree.BTree[row[K, R]]
+	key     func(R) K
+	cmp     func(a, b K) int
+	indexes []secondary[R]
+}
+
+// New returns an empty table whose records are identified by key and
+// ordered by cmp. The table maintains each of the given indexes.
+func New[K, R any](
+	key func(R) K,
+	cmp func(a, b K) int,
+	indexes ...Index[R],
+) *Table[K, R] {
+	pkcmp := func(a, b R) int {
+		return cmp(key(a), key(b))
+	}
+	t := &Table[K, R]{
+		primary: btree.Empty(
+			func(a, b row[K, R]) int {
+				return cmp(a.key, b.key)
+			},
+			// Records are opaque so a record stored under an
+			// existing key always replaces the old one.
+			func(a, b row[K, R]) bool {
+				return false
+			},
+		),
+		key: key,
+		cmp: cmp,
+	}
+	for _, idx := range indexes {
+		t.indexes = append(t.indexes, idx.build(pkcmp))
+	}
+	return t
+}
+
+func (t *Table[K, R]) Contains(key K) bool {
+	return t.primary.Contains(row[K, R]{key: key})
+}
+
+func (t *Table[K, R]) Get(key K) (R, bool) {
+	r, ok := t.primary.Find(row[K, R]{key: key})
+	return r.rec, ok
+}
+
+func (t *Table[K, R]) Len() int {
+	return t.primary.Length()
+}
+
+// Insert returns a table that also contains rec. It fails with
+// ErrExists if a record with the same primary key is present and with
+// ErrDuplicate if rec conflicts with a record in a unique index.
+func (t *Table[K, R]) Insert(rec R) (*Table[K, R], error) {
+	key := t.key(rec)
+	if t.Contains(key) {
+		return t, fmt.Errorf("%w: %v", ErrExists, key)
+	}
+	if err := t.check(rec); err != nil {
+		return t, err
+	}
+	return t.with(row[K, R]{key: key, rec: rec}, nil), nil
+}
+
+// Update returns a table where rec replaces the record with the same
+// primary key. It fails with ErrNotFound if there is no such record
+// and with ErrDuplicate if rec conflicts with a record in a unique
+// index.
+func (t *Table[K, R]) Update(rec R) (*Table[K, R], error) {
+	key := t.key(rec)
+	old, ok := t.primary.Find(row[K, R]{key: key})
+	if !ok {
+		return t, fmt.Errorf("%w: %v", ErrNotFound, key)
+	}
+	if err := t.check(rec); err != nil {
+		return t, err
+	}
+	return t.with(row[K, R]{key: key, rec: rec}, &old.rec), nil
+}
+
+// Put inserts rec or replaces the record with the same primary key.
+// It fails with ErrDuplicate if rec conflicts with a record in a
+// unique index.
+func (t *Table[K, R]) Put(rec R) (*Table[K, R], error) {
+	if t.Contains(t.key(rec)) {
+		return t.Update(rec)
+	}
+	return t.Insert(rec)
+}
+
+// Delete returns a table without the record with the given primary
+// key.
+func (t *Table[K, R]) Delete(key K) *Table[K, R] {
+	old, ok := t.primary.Find(row[K, R]{key: key})
+	if !ok {
+		return t
+	}
+	nt := &Table[K, R]{
+		primary: t.primary.Delete(old),
+		key:     t.key,
+		cmp:     t.cmp,
+		indexes: make([]secondary[R], len(t.indexes)),
+	}
+	for i, idx := range t.indexes {
+		nt.indexes[i] = idx.remove(old.rec)
+	}
+	return nt
+}
+
+// All allows one to range over the records in primary key order.
+func (t *Table[K, R]) All() iter.Seq[R] {
+	return records(t.primary.Iterator)
+}
+
+// Range allows one to range over the records whose primary key is at
+// least lo and below hi, in primary key order.
+func (t *Table[K, R]) Range(lo, hi K) iter.Seq[R] {
+	return rangeRecords(t.primary.IteratorFrom, t.cmp, lo, hi)
+}
+
+func (t *Table[K, R]) AsTransient() *TTable[K, R] {
+	tt := &TTable[K, R]{
+		orig:    t,
+		primary: t.primary.AsTransient(),
+		key:     t.key,
+		cmp:     t.cmp,
+		indexes: make([]tsecondary[R], len(t.indexes)),
+	}
+	for i, idx := range t.indexes {
+		tt.indexes[i] = idx.asTransient()
+	}
+	return tt
+}
+
+func (t *Table[K, R]) check(rec R) error {
+	for _, idx := range t.indexes {
+		if err := idx.check(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// with returns a table containing r, replacing old in the indexes if
+// it is set.
+func (t *Table[K, R]) with(r row[K, R], old *R) *Table[K, R] {
+	nt := &Table[K, R]{
+		primary: t.primary.Add(r),
+		key:     t.key,
+		cmp:     t.cmp,
+		indexes: make([]secondary[R], len(t.indexes)),
+	}
+	for i, idx := range t.indexes {
+		if old != nil {
+			idx = idx.remove(*old)
+		}
+		nt.indexes[i] = idx.add(r.rec)
+	}
+	return nt
+}
+
+func (t *Table[K, R]) index(def any) any {
+	for _, idx := range t.indexes {
+		if idx.def() == def {
+			return idx
+		}
+	}
+	panic(ErrUnknownIndex)
+}
+
+// TTable is the transient counterpart of Table. Changes that fail
+// leave the transient as it was.
+type TTable[K, R any] struct {
+	orig    *Table[K, R]
+	primary *btree.TBTree[row[K, R]]
+	key     func(R) K
+	cmp     func(a, b K) int
+	indexes []tsecondary[R]
+}
+
+func (t *TTable[K, R]) Contains(key K) bool {
+	return t.primary.Contains(row[K, R]{key: key})
+}
+
+func (t *TTable[K, R]) Get(key K) (R, bool) {
+	r, ok := t.primary.Find(row[K, R]{key: key})
+	return r.rec, ok
+}
+
+func (t *TTable[K, R]) Len() int {
+	return t.primary.Length()
+}
+
+// Insert adds rec to the table. See (*Table[K, R]).Insert.
+func (t *TTable[K, R]) Insert(rec R) error {
+	key := t.key(rec)
+	if t.Contains(key) {
+		return fmt.Errorf("%w: %v", ErrExists, key)
+	}
+	if err := t.check(rec); err != nil {
+		return err
+	}
+	t.set(row[K, R]{key: key, rec: rec}, nil)
+	return nil
+}
+
+// Update replaces the record with the same primary key as rec. See
+// (*Table[K, R]).Update.
+func (t *TTable[K, R]) Update(rec R) error {
+	key := t.key(rec)
+	old, ok := t.primary.Find(row[K, R]{key: key})
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrNotFound, key)
+	}
+	if err := t.check(rec); err != nil {
+		return err
+	}
+	t.set(row[K, R]{key: key, rec: rec}, &old.rec)
+	return nil
+}
+
+// Put inserts rec or replaces the record with the same primary key.
+// See (*Table[K, R]).Put.
+func (t *TTable[K, R]) Put(rec R) error {
+	if t.Contains(t.key(rec)) {
+		return t.Update(rec)
+	}
+	return t.Insert(rec)
+}
+
+func (t *TTable[K, R]) Delete(key K) *TTable[K, R] {
+	old, ok := t.primary.Find(row[K, R]{key: key})
+	if !ok {
+		return t
+	}
+	t.primary.Delete(old)
+	for _, idx := range t.indexes {
+		idx.remove(old.rec)
+	}
+	return t
+}
+
+func (t *TTable[K, R]) All() iter.Seq[R] {
+	return records(t.primary.Iterator)
+}
+
+func (t *TTable[K, R]) Range(lo, hi K) iter.Seq[R] {
+	return rangeRecords(t.primary.IteratorFrom, t.cmp, lo, hi)
+}
+
+func (t *TTable[K, R]) AsPersistent() *Table[K, R] {
+	nprimary := t.primary.AsPersistent()
+	indexes := make([]secondary[R], len(t.indexes))
+	for i, idx := range t.indexes {
+		indexes[i] = idx.asPersistent()
+	}
+	if nprimary == t.orig.primary {
+		return t.orig
+	}
+	return &Table[K, R]{
+		primary: nprimary,
+		key:     t.key,
+		cmp:     t.cmp,
+		indexes: indexes,
+	}
+}
+
+func (t *TTable[K, R]) check(rec R) error {
+	for _, idx := range t.indexes {
+		if err := idx.check(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TTable[K, R]) set(r row[K, R], old *R) {
+	t.primary.Add(r)
+	for _, idx := range t.indexes {
+		if old != nil {
+			idx.remove(*old)
+		}
+		idx.add(r.rec)
+	}
+}
+
+func (t *TTable[K, R]) index(def any) any {
+	for _, idx := range t.indexes {
+		if idx.def() == def {
+			return idx
+		}
+	}
+	panic(ErrUnknownIndex)
+}
+
+func records[K, R any](iterator func() btree.Iterator[row[K, R]]) iter.Seq[R] {
+	return func(yield func(R) bool) {
+		i := iterator()
+		for i.HasNext() {
+			if !yield(i.Next().rec) {
+				return
+			}
+		}
+	}
+}
+
+func rangeRecords[K, R any](
+	iteratorFrom func(row[K, R]) btree.Iterator[row[K, R]],
+	cmp func(a, b K) int,
+	lo, hi K,
+) iter.Seq[R] {
+	return func(yield func(R) bool) {
+		i := iteratorFrom(row[K, R]{key: lo})
+		for i.HasNext() {
+			r := i.Next()
+			if cmp(r.key, hi) >= 0 || !yield(r.rec) {
+				return
+			}
+		}
+	}
+}
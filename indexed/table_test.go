@@ -0,0 +1,156 @@
+package indexed_test
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"jsouthworth.net/go/btree/indexed"
+)
+
+type user struct {
+	id      int
+	email   string
+	created int
+}
+
+var (
+	byEmail = indexed.NewUniqueIndex("email",
+		func(u user) string { return u.email }, strings.Compare)
+	byCreated = indexed.NewIndex("created",
+		func(u user) int { return u.created }, cmp.Compare[int])
+)
+
+func newTable() *indexed.Table[int, user] {
+	return indexed.New(func(u user) int { return u.id },
+		cmp.Compare[int], byEmail, byCreated)
+}
+
+func ids(seq func(func(user) bool)) []int {
+	var out []int
+	for u := range seq {
+		out = append(out, u.id)
+	}
+	return out
+}
+
+func TestTable(t *testing.T) {
+	t0 := newTable()
+	t1, err := t0.Insert(user{id: 1, email: "a@x", created: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := t1.Insert(user{id: 2, email: "b@x", created: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t3, err := t2.Insert(user{id: 3, email: "c@x", created: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := t3.Insert(user{id: 1, email: "z@x"}); !errors.Is(err, indexed.ErrExists) {
+		t.Fatalf("got %v expected %v", err, indexed.ErrExists)
+	}
+	if _, err := t3.Insert(user{id: 4, email: "a@x"}); !errors.Is(err, indexed.ErrDuplicate) {
+		t.Fatalf("got %v expected %v", err, indexed.ErrDuplicate)
+	}
+	if _, err := t3.Update(user{id: 4}); !errors.Is(err, indexed.ErrNotFound) {
+		t.Fatalf("got %v expected %v", err, indexed.ErrNotFound)
+	}
+	if _, err := t3.Update(user{id: 2, email: "c@x"}); !errors.Is(err, indexed.ErrDuplicate) {
+		t.Fatalf("got %v expected %v", err, indexed.ErrDuplicate)
+	}
+
+	// Keeping its own unique key is not a conflict.
+	t4, err := t3.Update(user{id: 1, email: "a@x", created: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(indexed.Ascend(t4, byCreated)); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("t4 by created: got %v", got)
+	}
+	if got := ids(indexed.Ascend(t3, byCreated)); !slices.Equal(got, []int{2, 1, 3}) {
+		t.Fatalf("t3 by created: got %v", got)
+	}
+	if got := ids(indexed.Lookup(t3, byCreated, 10)); !slices.Equal(got, []int{1, 3}) {
+		t.Fatalf("lookup created 10: got %v", got)
+	}
+	if got := ids(indexed.Range(t3, byEmail, "b", "c")); !slices.Equal(got, []int{2}) {
+		t.Fatalf("range b..c: got %v", got)
+	}
+	if got := ids(t3.Range(2, 4)); !slices.Equal(got, []int{2, 3}) {
+		t.Fatalf("range 2..4: got %v", got)
+	}
+	if u, ok := indexed.Get(t3, byEmail, "c@x"); !ok || u.id != 3 {
+		t.Fatalf("get c@x: got %v %v", u, ok)
+	}
+
+	t5 := t4.Delete(3)
+	if _, ok := indexed.Get(t5, byEmail, "c@x"); ok {
+		t.Fatal("deleted record still indexed")
+	}
+	if t5.Delete(3) != t5 || t5.Len() != 2 || t4.Len() != 3 {
+		t.Fatalf("got lengths %v %v", t5.Len(), t4.Len())
+	}
+	// The freed unique key may be reused.
+	if _, err := t5.Insert(user{id: 9, email: "c@x"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransientTable(t *testing.T) {
+	tt := newTable().AsTransient()
+	for i := 0; i < 1000; i++ {
+		err := tt.Insert(user{id: i, email: string(rune('a'+i%26)) +
+			strings.Repeat("x", i/26), created: i % 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tt.Put(user{id: 5, email: "a"}); !errors.Is(err, indexed.ErrDuplicate) {
+		t.Fatalf("got %v expected %v", err, indexed.ErrDuplicate)
+	}
+	if u, _ := tt.Get(5); u.email != "f" {
+		t.Fatalf("failed put changed the record: %v", u)
+	}
+	if err := tt.Put(user{id: 5, email: "new", created: 100}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 500; i < 1000; i++ {
+		tt.Delete(i)
+	}
+	if got := ids(indexed.Lookup(tt, byCreated, 100)); !slices.Equal(got, []int{5}) {
+		t.Fatalf("lookup created 100: got %v", got)
+	}
+	tbl := tt.AsPersistent()
+	if tbl.Len() != 500 {
+		t.Fatalf("got len %v", tbl.Len())
+	}
+	var n int
+	for u := range indexed.Ascend(tbl, byEmail) {
+		if got, ok := indexed.Get(tbl, byEmail, u.email); !ok || got != u {
+			t.Fatalf("get %q: got %v %v", u.email, got, ok)
+		}
+		n++
+	}
+	if n != 500 {
+		t.Fatalf("email index has %v records", n)
+	}
+	if got := len(ids(indexed.From(tbl, byCreated, 6))); got != 72 {
+		t.Fatalf("created from 6: got %v records", got)
+	}
+}
+
+func TestUnknownIndex(t *testing.T) {
+	other := indexed.NewIndex("other",
+		func(u user) int { return u.id }, cmp.Compare[int])
+	defer func() {
+		if r := recover(); r != indexed.ErrUnknownIndex {
+			t.Fatalf("got %v expected %v", r, indexed.ErrUnknownIndex)
+		}
+	}()
+	indexed.Lookup(newTable(), other, 1)
+}
@@ -0,0 +1,103 @@
+// Package bloom implements the bloom filters used to skip lookups of
+// absent keys.
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+// Filter is a bloom filter over 64 bit hashes. The k probes of a hash
+// are derived from its two halves by double hashing.
+type Filter struct {
+	bits []uint64
+	k    uint32
+}
+
+// New returns a filter sized for n hashes with the false positive rate
+// fpRate.
+func New(n int, fpRate float64) *Filter {
+	n = max(n, 1)
+	fpRate = min(max(fpRate, 1e-9), 0.5)
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := max(uint32(math.Round(m/float64(n)*math.Ln2)), 1)
+	return &Filter{
+		bits: make([]uint64, (uint64(m)+63)/64),
+		k:    k,
+	}
+}
+
+func (f *Filter) Add(h uint64) {
+	h = mix(h)
+	n := uint64(len(f.bits)) * 64
+	h1, h2 := h, h>>32|h<<32|1
+	for i := uint32(0); i < f.k; i++ {
+		bit := h1 % n
+		f.bits[bit/64] |= 1 << (bit % 64)
+		h1 += h2
+	}
+}
+
+func (f *Filter) Clone() *Filter {
+	return &Filter{bits: slices.Clone(f.bits), k: f.k}
+}
+
+// MayContain reports whether h may have been added. It is never false
+// for a hash that was added.
+func (f *Filter) MayContain(h uint64) bool {
+	h = mix(h)
+	n := uint64(len(f.bits)) * 64
+	h1, h2 := h, h>>32|h<<32|1
+	for i := uint32(0); i < f.k; i++ {
+		bit := h1 % n
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+		h1 += h2
+	}
+	return true
+}
+
+// AppendBinary appends the encoding of f to b.
+func (f *Filter) AppendBinary(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, f.k)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(f.bits)))
+	for _, w := range f.bits {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+	return b
+}
+
+var errCorrupt = errors.New("corrupt bloom filter")
+
+// Decode returns the filter encoded at the start of b by AppendBinary
+// and the rest of b.
+func Decode(b []byte) (*Filter, []byte, error) {
+	if len(b) < 8 {
+		return nil, nil, errCorrupt
+	}
+	k := binary.LittleEndian.Uint32(b)
+	words := uint64(binary.LittleEndian.Uint32(b[4:]))
+	b = b[8:]
+	if k == 0 || words == 0 || uint64(len(b)) < words*8 {
+		return nil, nil, errCorrupt
+	}
+	f := &Filter{bits: make([]uint64, words), k: k}
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(b[i*8:])
+	}
+	return f, b[words*8:], nil
+}
+
+// mix scrambles h with the splitmix64 finalizer so that weak hashes
+// still spread over the whole filter.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,33 @@
+package bloom
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	for _, rate := range []float64{0.1, 0.01, 0.001} {
+		f := New(n, rate)
+		for i := uint64(0); i < n; i++ {
+			f.Add(i)
+		}
+		g, rest, err := Decode(f.AppendBinary(nil))
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("decoding: %v", err)
+		}
+		for i := uint64(0); i < n; i++ {
+			if !g.MayContain(i) {
+				t.Fatalf("false negative for %v", i)
+			}
+		}
+		var fp int
+		for i := uint64(n); i < 11*n; i++ {
+			if g.MayContain(i) {
+				fp++
+			}
+		}
+		if got := float64(fp) / (10 * n); got > 1.5*rate {
+			t.Fatalf("got false positive rate %v expected %v", got, rate)
+		}
+	}
+}
@@ -24,6 +24,18 @@ func newNode[T any](len int8, edit *atomic.Bool) *internalNode[T] {
 	}
 }
 
+// child returns the i-th child of n, loading it if it is a page that
+// has not been read. Every access to a child that looks inside it
+// goes through child; copying children between nodes does not need
+// to.
+func (n *internalNode[T]) child(i int8) *node[T] {
+	c := n.children[i]
+	if c.kind == nodeKindPage {
+		return c.asPageNode().load()
+	}
+	return c
+}
+
 func (n *internalNode[T]) sizeOfChildArray() int8 {
 	return int8(len(n.children))
 }
@@ -38,24 +50,30 @@ func (n *internalNode[T]) find(key T, cmp compareFunc[T]) (T, bool) {
 	if idx == n.len {
 		return zeroVal, false
 	}
-	return n.children[idx].find(key, cmp)
+	return n.child(idx).find(key, cmp)
 }
 
 func (n *internalNode[T]) add(
 	key T,
+	merge mergeFunc[T],
 	cmp compareFunc[T],
 	eq eqFunc[T],
 	edit *atomic.Bool,
 ) nodeReturn[T] {
 	idx, _ := n.searchEq(key, cmp, eq)
-	if idx >= 0 {
+	if idx >= 0 && merge == nil {
 		return nodeReturn[T]{status: returnUnchanged}
 	}
-	ins := -idx - 1
+	// A key equal to the maximum of a child still has to reach
+	// the leaf to be merged with it.
+	ins := idx
+	if ins < 0 {
+		ins = -idx - 1
+	}
 	if ins == n.len {
 		ins = n.len - 1
 	}
-	ret := n.children[ins].add(key, cmp, eq, edit)
+	ret := n.child(ins).add(key, merge, cmp, eq, edit)
 	switch ret.status {
 	case returnUnchanged:
 		return ret
@@ -102,8 +120,12 @@ func (n *internalNode[T]) copyAndModify(
 	newNode *node[T],
 	status returnStatus,
 ) nodeReturn[T] {
+	// The arrays may only be shared with n if the new node is
+	// persistent, otherwise editing it in place would modify n.
+	shared := !edit.Deref()
+
 	var newKeys []T
-	if eq(newNode.maxKey(), n.keys[ins]) {
+	if shared && eq(newNode.maxKey(), n.keys[ins]) {
 		newKeys = n.keys
 	} else {
 		newKeys = make([]T, n.len)
@@ -112,7 +134,7 @@ func (n *internalNode[T]) copyAndModify(
 	}
 
 	var newChildren []*node[T]
-	if newNode == n.children[ins] {
+	if shared && newNode == n.children[ins] {
 		newChildren = n.children
 	} else {
 		newChildren = make([]*node[T], n.len)
@@ -224,7 +246,7 @@ func (n *internalNode[T]) split(
 }
 
 func (n *internalNode[T]) remove(
-	key T,
+	r *removal[T],
 	leftNode, rightNode *node[T],
 	cmp compareFunc[T],
 	edit *atomic.Bool,
@@ -237,33 +259,30 @@ func (n *internalNode[T]) remove(
 		right = rightNode.asInternalNode()
 	}
 	return n.removeInternal(
-		key, left, right, cmp, edit)
+		r, left, right, cmp, edit)
 }
 
 func (n *internalNode[T]) removeInternal(
-	key T,
+	r *removal[T],
 	left, right *internalNode[T],
 	cmp compareFunc[T],
 	edit *atomic.Bool,
 ) nodeReturn[T] {
-	idx := n.search(key, cmp)
-	if idx < 0 {
-		idx = -idx - 1
-	}
+	idx := r.childIndex(n.asNode(), cmp)
 	if idx == n.len {
 		return nodeReturn[T]{status: returnUnchanged}
 	}
 
 	var leftChild *node[T]
 	if idx > 0 {
-		leftChild = n.children[idx-1]
+		leftChild = n.child(idx - 1)
 	}
 	var rightChild *node[T]
 	if idx < n.len-1 {
-		rightChild = n.children[idx+1]
+		rightChild = n.child(idx + 1)
 	}
 
-	ret := n.children[idx].remove(key, leftChild, rightChild, cmp, edit)
+	ret := n.child(idx).remove(r, leftChild, rightChild, cmp, edit)
 	switch ret.status {
 	case returnUnchanged:
 		return ret
@@ -593,7 +612,7 @@ func (n *internalNode[T]) string(b *strings.Builder, lvl int) {
 			b.WriteString("| ")
 		}
 		fmt.Fprintf(b, "%v: ", n.keys[i])
-		n.children[i].string(b, lvl+1)
+		n.child(i).string(b, lvl+1)
 	}
 }
 
@@ -0,0 +1,211 @@
+// Package intervaltree implements a persistent interval tree on top
+// of the augmented B+Tree. Intervals are ordered by their start and
+// every node caches the maximum end of the intervals below it, which
+// allows overlap queries to skip subtrees that end too early.
+package intervaltree
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Interval is a closed interval [Start, End] carrying a Value.
+type Interval[K, V any] struct {
+	Start K
+	End   K
+	Value V
+}
+
+type Tree[K, V any] struct {
+	impl *btree.AugBTree[Interval[K, V], maxEnd[K]]
+	cmp  func(a, b K) int
+}
+
+// Empty returns an empty interval tree. Intervals are identified by
+// their start and end; adding an interval that is already present
+// replaces its value.
+func Empty[K, V any](cmp func(a, b K) int, eq func(a, b V) bool) *Tree[K, V] {
+	return &Tree[K, V]{
+		impl: btree.EmptyAugmented[Interval[K, V], maxEnd[K]](
+			func(a, b Interval[K, V]) int {
+				return compareIntervals(cmp, a, b)
+			},
+			func(a, b Interval[K, V]) bool {
+				return compareIntervals(cmp, a, b) == 0 &&
+					eq(a.Value, b.Value)
+			},
+			endMonoid[K, V]{cmp: cmp},
+		),
+		cmp: cmp,
+	}
+}
+
+func (t *Tree[K, V]) Contains(start, end K) bool {
+	return t.impl.Contains(Interval[K, V]{Start: start, End: end})
+}
+
+func (t *Tree[K, V]) Find(start, end K) (V, bool) {
+	iv, ok := t.impl.Find(Interval[K, V]{Start: start, End: end})
+	return iv.Value, ok
+}
+
+// Add returns a tree containing the interval [start, end] with the
+// given value. start must not be after end.
+func (t *Tree[K, V]) Add(start, end K, value V) *Tree[K, V] {
+	nimpl := t.impl.Add(Interval[K, V]{Start: start, End: end, Value: value})
+	if nimpl == t.impl {
+		return t
+	}
+	return &Tree[K, V]{
+		impl: nimpl,
+		cmp:  t.cmp,
+	}
+}
+
+func (t *Tree[K, V]) Delete(start, end K) *Tree[K, V] {
+	nimpl := t.impl.Delete(Interval[K, V]{Start: start, End: end})
+	if nimpl == t.impl {
+		return t
+	}
+	return &Tree[K, V]{
+		impl: nimpl,
+		cmp:  t.cmp,
+	}
+}
+
+func (t *Tree[K, V]) Len() int {
+	return t.impl.Length()
+}
+
+// All allows one to range over every interval ordered by start.
+func (t *Tree[K, V]) All() iter.Seq[Interval[K, V]] {
+	return t.impl.All()
+}
+
+// Overlapping allows one to range over the intervals that overlap
+// [lo, hi], ordered by start.
+func (t *Tree[K, V]) Overlapping(lo, hi K) iter.Seq[Interval[K, V]] {
+	return overlapping(t.impl.Select, t.cmp, lo, hi)
+}
+
+// Stab allows one to range over the intervals containing point.
+func (t *Tree[K, V]) Stab(point K) iter.Seq[Interval[K, V]] {
+	return t.Overlapping(point, point)
+}
+
+func (t *Tree[K, V]) AsTransient() *TTree[K, V] {
+	return &TTree[K, V]{
+		orig: t,
+		impl: t.impl.AsTransient(),
+		cmp:  t.cmp,
+	}
+}
+
+type TTree[K, V any] struct {
+	orig *Tree[K, V]
+	impl *btree.TAugBTree[Interval[K, V], maxEnd[K]]
+	cmp  func(a, b K) int
+}
+
+func (t *TTree[K, V]) Contains(start, end K) bool {
+	return t.impl.Contains(Interval[K, V]{Start: start, End: end})
+}
+
+func (t *TTree[K, V]) Find(start, end K) (V, bool) {
+	iv, ok := t.impl.Find(Interval[K, V]{Start: start, End: end})
+	return iv.Value, ok
+}
+
+func (t *TTree[K, V]) Add(start, end K, value V) *TTree[K, V] {
+	t.impl.Add(Interval[K, V]{Start: start, End: end, Value: value})
+	return t
+}
+
+func (t *TTree[K, V]) Delete(start, end K) *TTree[K, V] {
+	t.impl.Delete(Interval[K, V]{Start: start, End: end})
+	return t
+}
+
+func (t *TTree[K, V]) Len() int {
+	return t.impl.Length()
+}
+
+func (t *TTree[K, V]) All() iter.Seq[Interval[K, V]] {
+	return t.impl.All()
+}
+
+func (t *TTree[K, V]) Overlapping(lo, hi K) iter.Seq[Interval[K, V]] {
+	return overlapping(t.impl.Select, t.cmp, lo, hi)
+}
+
+func (t *TTree[K, V]) Stab(point K) iter.Seq[Interval[K, V]] {
+	return t.Overlapping(point, point)
+}
+
+func (t *TTree[K, V]) AsPersistent() *Tree[K, V] {
+	nimpl := t.impl.AsPersistent()
+	if nimpl == t.orig.impl {
+		return t.orig
+	}
+	return &Tree[K, V]{
+		impl: nimpl,
+		cmp:  t.cmp,
+	}
+}
+
+func overlapping[K, V any](
+	sel func(func(maxEnd[K]) bool) iter.Seq[Interval[K, V]],
+	cmp func(a, b K) int,
+	lo, hi K,
+) iter.Seq[Interval[K, V]] {
+	return func(yield func(Interval[K, V]) bool) {
+		endsAfterLo := func(m maxEnd[K]) bool {
+			return m.ok && cmp(m.end, lo) >= 0
+		}
+		for iv := range sel(endsAfterLo) {
+			if cmp(iv.Start, hi) > 0 || !yield(iv) {
+				return
+			}
+		}
+	}
+}
+
+func compareIntervals[K, V any](cmp func(a, b K) int, a, b Interval[K, V]) int {
+	if c := cmp(a.Start, b.Start); c != 0 {
+		return c
+	}
+	return cmp(a.End, b.End)
+}
+
+// maxEnd is the summary kept for every node, the largest end of the
+// intervals below it. ok is false for the identity.
+type maxEnd[K any] struct {
+	end K
+	ok  bool
+}
+
+type endMonoid[K, V any] struct {
+	cmp func(a, b K) int
+}
+
+func (m endMonoid[K, V]) Identity() maxEnd[K] {
+	return maxEnd[K]{}
+}
+
+func (m endMonoid[K, V]) Measure(iv Interval[K, V]) maxEnd[K] {
+	return maxEnd[K]{end: iv.End, ok: true}
+}
+
+func (m endMonoid[K, V]) Combine(a, b maxEnd[K]) maxEnd[K] {
+	switch {
+	case !a.ok:
+		return b
+	case !b.ok:
+		return a
+	case m.cmp(a.end, b.end) >= 0:
+		return a
+	default:
+		return b
+	}
+}
@@ -0,0 +1,78 @@
+package intervaltree_test
+
+import (
+	"cmp"
+	"math/rand"
+	"testing"
+
+	"jsouthworth.net/go/btree/intervaltree"
+)
+
+func eqInt(a, b int) bool {
+	return a == b
+}
+
+func TestOverlapping(t *testing.T) {
+	type window struct{ start, end int }
+	rnd := rand.New(rand.NewSource(1))
+	var windows []window
+	tree := intervaltree.Empty[int, int](cmp.Compare[int], eqInt).AsTransient()
+	for i := 0; i < 5000; i++ {
+		start := rnd.Intn(100000)
+		end := start + rnd.Intn(1000)
+		if tree.Contains(start, end) {
+			continue
+		}
+		windows = append(windows, window{start, end})
+		tree.Add(start, end, i)
+	}
+	p := tree.AsPersistent()
+	for i := 0; i < 200; i++ {
+		lo := rnd.Intn(101000)
+		hi := lo + rnd.Intn(500)
+		var expected int
+		for _, w := range windows {
+			if w.start <= hi && w.end >= lo {
+				expected++
+			}
+		}
+		var got int
+		prev := -1
+		for iv := range p.Overlapping(lo, hi) {
+			if iv.Start > hi || iv.End < lo || iv.Start < prev {
+				t.Fatalf("unexpected interval %v for [%v, %v]", iv, lo, hi)
+			}
+			prev = iv.Start
+			got++
+		}
+		if got != expected {
+			t.Fatalf("[%v, %v]: got %v intervals expected %v",
+				lo, hi, got, expected)
+		}
+	}
+}
+
+func TestStabAfterDelete(t *testing.T) {
+	v1 := intervaltree.Empty[int, string](cmp.Compare[int],
+		func(a, b string) bool { return a == b }).
+		Add(0, 10, "a").
+		Add(5, 6, "b").
+		Add(20, 30, "c")
+	v2 := v1.Delete(0, 10)
+	count := func(tr *intervaltree.Tree[int, string], p int) int {
+		var n int
+		for range tr.Stab(p) {
+			n++
+		}
+		return n
+	}
+	if got := count(v1, 5); got != 2 {
+		t.Fatalf("v1.Stab(5) got %v intervals expected 2", got)
+	}
+	if got := count(v2, 5); got != 1 {
+		t.Fatalf("v2.Stab(5) got %v intervals expected 1", got)
+	}
+	if got := count(v2, 8); got != 0 {
+		t.Fatalf("v2.Stab(8) got %v intervals expected 0", got)
+	}
+}
@@ -0,0 +1,329 @@
+// Package keyenc encodes tuples of values into byte strings whose
+// bytewise order matches the order of the tuples compared column by
+// column. This allows multi-column keys to be stored in a
+// BTree[string] or treemap.Map[string, V] ordered by strings.Compare
+// without writing a comparator for every key type.
+//
+// Supported column types are the signed and unsigned integers,
+// float32 and float64, string, []byte, bool and time.Time. Any column
+// may be wrapped with Desc to sort it in descending order. Keys
+// compared with each other must use the same column types in the same
+// positions.
+package keyenc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+const (
+	// ErrUnsupportedType is returned when encoding a value of a type
+	// keyenc does not know how to order.
+	ErrUnsupportedType = Error("unsupported type")
+	// ErrCorrupt is returned when decoding a key that was not
+	// produced by this package.
+	ErrCorrupt = Error("corrupt key")
+	// ErrMismatch is returned by Scan when a column does not have
+	// the type of its destination.
+	ErrMismatch = Error("column type mismatch")
+)
+
+// Every column starts with a tag naming its type. Descending columns
+// have every byte inverted, including the tag, so the direction can be
+// recovered when decoding.
+const (
+	tagFalse  byte = 0x20
+	tagTrue   byte = 0x21
+	tagInt    byte = 0x30
+	tagUint   byte = 0x31
+	tagFloat  byte = 0x32
+	tagTime   byte = 0x33
+	tagBytes  byte = 0x40
+	tagString byte = 0x41
+)
+
+// Strings are terminated by a zero byte followed by escEnd and zero
+// bytes within them are followed by escZero. A string therefore sorts
+// before any longer string it is a prefix of.
+const (
+	escEnd  byte = 0x01
+	escZero byte = 0xff
+)
+
+const signBit = 1 << 63
+
+type desc struct {
+	v any
+}
+
+// Desc marks v to be encoded in descending order.
+func Desc(v any) any {
+	return desc{v: v}
+}
+
+// Encode returns the encoding of the tuple vals.
+func Encode(vals ...any) ([]byte, error) {
+	return Append(nil, vals...)
+}
+
+// EncodeString returns the encoding of the tuple vals as a string.
+func EncodeString(vals ...any) (string, error) {
+	b, err := Append(nil, vals...)
+	return string(b), err
+}
+
+// Append appends the encoding of the tuple vals to dst. Appending the
+// encodings of two tuples is the same as encoding their concatenation.
+func Append(dst []byte, vals ...any) ([]byte, error) {
+	for _, v := range vals {
+		var mask byte
+		if d, ok := v.(desc); ok {
+			v, mask = d.v, 0xff
+		}
+		start := len(dst)
+		var err error
+		dst, err = appendValue(dst, v)
+		if err != nil {
+			return dst[:start], err
+		}
+		for i := start; mask != 0 && i < len(dst); i++ {
+			dst[i] ^= mask
+		}
+	}
+	return dst, nil
+}
+
+func appendValue(dst []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return append(dst, tagTrue), nil
+		}
+		return append(dst, tagFalse), nil
+	case int:
+		return appendInt(dst, int64(v)), nil
+	case int8:
+		return appendInt(dst, int64(v)), nil
+	case int16:
+		return appendInt(dst, int64(v)), nil
+	case int32:
+		return appendInt(dst, int64(v)), nil
+	case int64:
+		return appendInt(dst, v), nil
+	case uint:
+		return appendUint(dst, uint64(v)), nil
+	case uint8:
+		return appendUint(dst, uint64(v)), nil
+	case uint16:
+		return appendUint(dst, uint64(v)), nil
+	case uint32:
+		return appendUint(dst, uint64(v)), nil
+	case uint64:
+		return appendUint(dst, v), nil
+	case float32:
+		return appendFloat(dst, float64(v)), nil
+	case float64:
+		return appendFloat(dst, v), nil
+	case time.Time:
+		dst = binary.BigEndian.AppendUint64(append(dst, tagTime),
+			uint64(v.Unix())^signBit)
+		return binary.BigEndian.AppendUint32(dst,
+			uint32(v.Nanosecond())), nil
+	case string:
+		return appendEscaped(append(dst, tagString), v), nil
+	case []byte:
+		return appendEscaped(append(dst, tagBytes), v), nil
+	default:
+		return dst, fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+}
+
+// appendInt flips the sign bit so negative numbers sort first.
+func appendInt(dst []byte, v int64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, tagInt),
+		uint64(v)^signBit)
+}
+
+func appendUint(dst []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, tagUint), v)
+}
+
+// appendFloat flips the sign bit of positive numbers and every bit of
+// negative ones, which orders the IEEE 754 representation numerically.
+// Every NaN is encoded as the same value, sorting after +Inf, and -0
+// sorts before +0.
+func appendFloat(dst []byte, v float64) []byte {
+	bits := math.Float64bits(v)
+	if math.IsNaN(v) {
+		bits = math.Float64bits(math.NaN())
+	}
+	if bits&signBit != 0 {
+		bits = ^bits
+	} else {
+		bits ^= signBit
+	}
+	return binary.BigEndian.AppendUint64(append(dst, tagFloat), bits)
+}
+
+func appendEscaped[S ~string | ~[]byte](dst []byte, s S) []byte {
+	for i := 0; i < len(s); i++ {
+		dst = append(dst, s[i])
+		if s[i] == 0 {
+			dst = append(dst, escZero)
+		}
+	}
+	return append(dst, 0, escEnd)
+}
+
+// Decode returns the columns of key. Integers are returned as int64,
+// unsigned integers as uint64, floats as float64 and times in UTC.
+// Descending columns are returned as their original values.
+func Decode[S ~string | ~[]byte](key S) ([]any, error) {
+	var out []any
+	for len(key) > 0 {
+		v, n, err := decodeValue(key)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		key = key[n:]
+	}
+	return out, nil
+}
+
+// Scan decodes the columns of key into dst, which must hold one
+// pointer per column: *int64, *int, *uint64, *uint, *float64, *string,
+// *[]byte, *bool or *time.Time. A nil entry skips its column.
+func Scan[S ~string | ~[]byte](key S, dst ...any) error {
+	for i, d := range dst {
+		if len(key) == 0 {
+			return fmt.Errorf("%w: key has %d columns, expected %d",
+				ErrMismatch, i, len(dst))
+		}
+		v, n, err := decodeValue(key)
+		if err != nil {
+			return err
+		}
+		key = key[n:]
+		if err := assign(d, v); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	if len(key) != 0 {
+		return fmt.Errorf("%w: key has more than %d columns",
+			ErrMismatch, len(dst))
+	}
+	return nil
+}
+
+func assign(dst, v any) error {
+	ok := true
+	switch d := dst.(type) {
+	case nil:
+	case *int64:
+		*d, ok = v.(int64)
+	case *int:
+		var i int64
+		i, ok = v.(int64)
+		*d = int(i)
+	case *uint64:
+		*d, ok = v.(uint64)
+	case *uint:
+		var u uint64
+		u, ok = v.(uint64)
+		*d = uint(u)
+	case *float64:
+		*d, ok = v.(float64)
+	case *string:
+		*d, ok = v.(string)
+	case *[]byte:
+		*d, ok = v.([]byte)
+	case *bool:
+		*d, ok = v.(bool)
+	case *time.Time:
+		*d, ok = v.(time.Time)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, dst)
+	}
+	if !ok {
+		return fmt.Errorf("%w: cannot store %T in %T", ErrMismatch, v, dst)
+	}
+	return nil
+}
+
+// decodeValue decodes the first column of key, returning it and the
+// number of bytes it used.
+func decodeValue[S ~string | ~[]byte](key S) (any, int, error) {
+	var mask byte
+	tag := key[0]
+	if tag >= 0x80 {
+		mask = 0xff
+		tag ^= mask
+	}
+	// word reads the big endian number held in the n bytes after the
+	// first off bytes of key.
+	word := func(off, n int) uint64 {
+		var v uint64
+		for i := off; i < off+n; i++ {
+			v = v<<8 | uint64(key[i]^mask)
+		}
+		return v
+	}
+	switch tag {
+	case tagFalse, tagTrue:
+		return tag == tagTrue, 1, nil
+	case tagInt, tagUint, tagFloat:
+		if len(key) < 9 {
+			return nil, 0, ErrCorrupt
+		}
+		v := word(1, 8)
+		switch {
+		case tag == tagInt:
+			return int64(v ^ signBit), 9, nil
+		case tag == tagUint:
+			return v, 9, nil
+		case v&signBit != 0:
+			return math.Float64frombits(v ^ signBit), 9, nil
+		default:
+			return math.Float64frombits(^v), 9, nil
+		}
+	case tagTime:
+		if len(key) < 13 {
+			return nil, 0, ErrCorrupt
+		}
+		sec, nsec := int64(word(1, 8)^signBit), int64(word(9, 4))
+		return time.Unix(sec, nsec).UTC(), 13, nil
+	case tagString, tagBytes:
+		b := []byte{}
+		for i := 1; i+1 < len(key); i++ {
+			c := key[i] ^ mask
+			if c != 0 {
+				b = append(b, c)
+				continue
+			}
+			switch key[i+1] ^ mask {
+			case escZero:
+				b = append(b, 0)
+				i++
+			case escEnd:
+				if tag == tagString {
+					return string(b), i + 2, nil
+				}
+				return b, i + 2, nil
+			default:
+				return nil, 0, ErrCorrupt
+			}
+		}
+		return nil, 0, ErrCorrupt
+	default:
+		return nil, 0, ErrCorrupt
+	}
+}
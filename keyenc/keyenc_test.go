@@ -0,0 +1,181 @@
+package keyenc_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree/keyenc"
+)
+
+func sign(c int) int {
+	switch {
+	case c < 0:
+		return -1
+	case c > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTuple(a, b []any) int {
+	for i := range a {
+		var c int
+		switch x := a[i].(type) {
+		case int64:
+			y := b[i].(int64)
+			if x < y {
+				c = -1
+			} else if x > y {
+				c = 1
+			}
+		case float64:
+			y := b[i].(float64)
+			if x < y {
+				c = -1
+			} else if x > y {
+				c = 1
+			}
+		case string:
+			c = bytes.Compare([]byte(x), []byte(b[i].(string)))
+		case bool:
+			y := b[i].(bool)
+			if x != y {
+				c = 1
+				if !x {
+					c = -1
+				}
+			}
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func TestOrder(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	parameters.MinSuccessfulTests = 1000
+	properties := gopter.NewProperties(parameters)
+	tuple := gen.SliceOfN(4, gen.Int64Range(-3, 3)).
+		Map(func(v []int64) []any {
+			// Draw each column from a small domain so that
+			// ties are common and later columns are compared.
+			strs := []string{"", "a", "a\x00", "a\x00b", "ab", "b"}
+			floats := []float64{math.Inf(-1), -1.5, -0.5, 0, 0.5, 2,
+				math.Inf(1)}
+			return []any{
+				v[0],
+				strs[(v[1]+3)%int64(len(strs))],
+				floats[v[2]+3],
+				v[3] > 0,
+			}
+		})
+	encode := func(v []any, descending bool) string {
+		cols := append([]any(nil), v...)
+		if descending {
+			cols[1] = keyenc.Desc(cols[1])
+		}
+		key, err := keyenc.EncodeString(cols...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	properties.Property("key order matches tuple order",
+		prop.ForAll(
+			func(a, b []any) bool {
+				ka, kb := encode(a, false), encode(b, false)
+				return sign(bytes.Compare([]byte(ka), []byte(kb))) ==
+					compareTuple(a, b)
+			},
+			tuple, tuple,
+		))
+	properties.Property("descending columns reverse their order",
+		prop.ForAll(
+			func(a, b []any) bool {
+				ka, kb := encode(a, true), encode(b, true)
+				c := compareTuple(a[:1], b[:1])
+				if c == 0 {
+					c = -compareTuple(a[1:2], b[1:2])
+				}
+				if c == 0 {
+					c = compareTuple(a[2:], b[2:])
+				}
+				return sign(bytes.Compare([]byte(ka), []byte(kb))) == c
+			},
+			tuple, tuple,
+		))
+	properties.Property("keys decode to their tuple",
+		prop.ForAll(
+			func(a []any, descending bool) bool {
+				got, err := keyenc.Decode(encode(a, descending))
+				return err == nil && reflect.DeepEqual(got, a)
+			},
+			tuple, gen.Bool(),
+		))
+	properties.TestingRun(t)
+}
+
+func TestScan(t *testing.T) {
+	now := time.Unix(-12345, 6789).UTC()
+	key, err := keyenc.Encode(int32(-7), uint8(200), float32(1.5),
+		keyenc.Desc("tenant\x00x"), []byte{0, 0xff}, true,
+		keyenc.Desc(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		i  int
+		u  uint64
+		f  float64
+		s  string
+		b  []byte
+		ok bool
+		ts time.Time
+	)
+	if err := keyenc.Scan(key, &i, &u, &f, &s, &b, &ok, &ts); err != nil {
+		t.Fatal(err)
+	}
+	if i != -7 || u != 200 || f != 1.5 || s != "tenant\x00x" ||
+		!bytes.Equal(b, []byte{0, 0xff}) || !ok || !ts.Equal(now) {
+		t.Fatalf("got %v %v %v %q %v %v %v", i, u, f, s, b, ok, ts)
+	}
+	if err := keyenc.Scan(key, &i); !errors.Is(err, keyenc.ErrMismatch) {
+		t.Fatalf("got %v expected %v", err, keyenc.ErrMismatch)
+	}
+	if err := keyenc.Scan(key, &s, nil, nil, nil, nil, nil, nil); !errors.Is(err, keyenc.ErrMismatch) {
+		t.Fatalf("got %v expected %v", err, keyenc.ErrMismatch)
+	}
+	if _, err := keyenc.Decode(key[:len(key)-1]); !errors.Is(err, keyenc.ErrCorrupt) {
+		t.Fatalf("got %v expected %v", err, keyenc.ErrCorrupt)
+	}
+	if _, err := keyenc.Encode(struct{}{}); !errors.Is(err, keyenc.ErrUnsupportedType) {
+		t.Fatalf("got %v expected %v", err, keyenc.ErrUnsupportedType)
+	}
+}
+
+func TestTimeOrder(t *testing.T) {
+	times := []time.Time{
+		time.Unix(-1, 999999999),
+		time.Unix(0, 0),
+		time.Unix(0, 1),
+		time.Date(2300, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	var prev []byte
+	for _, ts := range times {
+		key, _ := keyenc.Encode(ts)
+		if bytes.Compare(prev, key) >= 0 {
+			t.Fatalf("%v does not sort after its predecessor", ts)
+		}
+		prev = key
+	}
+}
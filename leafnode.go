@@ -14,6 +14,9 @@ type nodeKind uint8
 const (
 	nodeKindInternal nodeKind = iota
 	nodeKindLeaf
+	// nodeKindPage is a child of an internal node that is still
+	// to be read from a PageSource. See internalNode.child.
+	nodeKindPage
 )
 
 type node[T any] struct {
@@ -46,23 +49,79 @@ func (h *node[T]) find(key T, cmp compareFunc[T]) (T, bool) {
 	return h.asInternalNode().find(key, cmp)
 }
 
-func (h *node[T]) add(key T, cmp compareFunc[T], eq eqFunc[T], edit *atomic.Bool) nodeReturn[T] {
+func (h *node[T]) add(key T, merge mergeFunc[T], cmp compareFunc[T], eq eqFunc[T], edit *atomic.Bool) nodeReturn[T] {
 	if h.kind == nodeKindLeaf {
-		return h.asLeafNode().add(key, cmp, eq, edit)
+		return h.asLeafNode().add(key, merge, cmp, eq, edit)
 	}
-	return h.asInternalNode().add(key, cmp, eq, edit)
+	return h.asInternalNode().add(key, merge, cmp, eq, edit)
 }
 
-func (h *node[T]) remove(key T, left, right *node[T], cmp compareFunc[T], edit *atomic.Bool) nodeReturn[T] {
+func (h *node[T]) remove(r *removal[T], left, right *node[T], cmp compareFunc[T], edit *atomic.Bool) nodeReturn[T] {
 	if h.kind == nodeKindLeaf {
-		return h.asLeafNode().remove(key, left, right, cmp, edit)
+		return h.asLeafNode().remove(r, left, right, cmp, edit)
 	}
-	return h.asInternalNode().remove(key, left, right, cmp, edit)
+	return h.asInternalNode().remove(r, left, right, cmp, edit)
+}
+
+// mergeFunc combines the element old already in a tree with an equal
+// element new being added.
+type mergeFunc[T any] func(old, new T) T
+
+// removal selects the element a remove takes out of a subtree: the
+// one equal to key, or the first or last one if edge is set. The leaf
+// holding it records it in elem. If update is set it is called with
+// the element, and if it returns true the element is replaced by its
+// result, and kept set, instead of being removed.
+type removal[T any] struct {
+	key    T
+	edge   removalEdge
+	elem   T
+	update func(old T) (T, bool)
+	kept   bool
+}
+
+type removalEdge int8
+
+const (
+	removeKey removalEdge = iota
+	removeFirst
+	removeLast
+)
+
+// leafIndex returns the index of the element to remove from the leaf
+// n, or a negative number if there is none.
+func (r *removal[T]) leafIndex(n *node[T], cmp compareFunc[T]) int8 {
+	switch {
+	case n.len == 0:
+		return -1
+	case r.edge == removeFirst:
+		return 0
+	case r.edge == removeLast:
+		return n.len - 1
+	}
+	return n.search(r.key, cmp)
+}
+
+// childIndex returns the index of the child of the internal node n
+// holding the element to remove, or n.len if there is none.
+func (r *removal[T]) childIndex(n *node[T], cmp compareFunc[T]) int8 {
+	switch r.edge {
+	case removeFirst:
+		return 0
+	case removeLast:
+		return n.len - 1
+	}
+	idx := n.search(r.key, cmp)
+	if idx < 0 {
+		idx = -idx - 1
+	}
+	return idx
 }
 
 func (h *node[T]) string(b *strings.Builder, lvl int) {
 	if h.kind == nodeKindLeaf {
-		 h.asLeafNode().string(b, lvl)
+		h.asLeafNode().string(b, lvl)
+		return
 	}
 	h.asInternalNode().string(b, lvl)
 }
@@ -79,6 +138,61 @@ func (n *node[T]) maxKey() T {
 	return n.keys[n.len-1]
 }
 
+// first returns the smallest element below n by following the
+// leftmost spine.
+func (n *node[T]) first() (T, bool) {
+	for n.kind == nodeKindInternal {
+		n = n.asInternalNode().child(0)
+	}
+	if n.len == 0 {
+		var zero T
+		return zero, false
+	}
+	return n.keys[0], true
+}
+
+// last returns the largest element below n by following the
+// rightmost spine.
+func (n *node[T]) last() (T, bool) {
+	for n.kind == nodeKindInternal {
+		n = n.asInternalNode().child(n.len - 1)
+	}
+	if n.len == 0 {
+		var zero T
+		return zero, false
+	}
+	return n.maxKey(), true
+}
+
+// before returns the largest element below n that is less than key,
+// or equal to it as well if inclusive is set.
+func (n *node[T]) before(key T, inclusive bool, cmp compareFunc[T]) (T, bool) {
+	// i is the first position whose key is past the bound. For an
+	// internal node the answer is then either in child i or the
+	// largest element of child i-1.
+	i := int8(sort.Search(int(n.len), func(i int) bool {
+		c := cmp(n.keys[i], key)
+		return c > 0 || c == 0 && !inclusive
+	}))
+	if n.kind == nodeKindInternal && i < n.len {
+		in := n.asInternalNode()
+		if out, ok := in.child(i).before(key, inclusive, cmp); ok {
+			return out, true
+		}
+		if i > 0 {
+			return in.child(i - 1).last()
+		}
+	}
+	if n.kind == nodeKindInternal && i == n.len {
+		return n.last()
+	}
+	if n.kind == nodeKindLeaf && i > 0 {
+		return n.keys[i-1], true
+	}
+	var zero T
+	return zero, false
+}
+
 func (n *node[T]) search(key T, cmp compareFunc[T]) int8 {
 	i := int8(sort.Search(int(n.len), func(i int) bool {
 		return cmp(n.keys[i], key) >= 0
@@ -144,15 +258,19 @@ func (n *leafNode[T]) find(key T, cmp compareFunc[T]) (T, bool) {
 
 func (n *leafNode[T]) add(
 	key T,
+	merge mergeFunc[T],
 	cmp compareFunc[T],
 	eq eqFunc[T],
 	edit *atomic.Bool,
 ) (out nodeReturn[T]) {
-	idx, replace := n.searchEq(key, cmp, eq)
-	if idx >= 0 && !replace {
+	ins := n.searchFirst(key, cmp)
+	replace := ins < n.len && cmp(key, n.keys[ins]) == 0
+	if replace && merge != nil {
+		key = merge(n.keys[ins], key)
+	}
+	if replace && eq(key, n.keys[ins]) {
 		return nodeReturn[T]{status: returnUnchanged}
 	}
-	ins := (-idx) - 1
 
 	if n.isEditable() && (n.len < int8(len(n.keys)) || replace) {
 		return n.modifyInPlace(ins, key, edit, replace)
@@ -257,15 +375,16 @@ func (n *leafNode[T]) split(
 }
 
 func (n *leafNode[T]) remove(
-	key T,
+	r *removal[T],
 	leftNode, rightNode *node[T],
 	cmp compareFunc[T],
 	edit *atomic.Bool,
 ) (out nodeReturn[T]) {
-	idx := n.search(key, cmp)
+	idx := r.leafIndex(n.asNode(), cmp)
 	if idx < 0 {
 		return nodeReturn[T]{status: returnUnchanged}
 	}
+	r.elem = n.keys[idx]
 
 	newLen := n.len - 1
 
@@ -277,6 +396,13 @@ func (n *leafNode[T]) remove(
 		right = rightNode.asNode()
 	}
 
+	if r.update != nil {
+		if elem, keep := r.update(r.elem); keep {
+			r.kept = true
+			return n.replaceIdx(idx, elem, left, right, edit)
+		}
+	}
+
 	switch {
 	case !n.needsMerge(newLen, left, right):
 		if n.isEditable() {
@@ -326,6 +452,35 @@ func (n *leafNode[T]) removeInPlace(
 	return nodeReturn[T]{status: returnEarly}
 }
 
+// replaceIdx swaps the element at idx for elem, which must compare
+// equal to it, leaving the siblings left and right as they are.
+func (n *leafNode[T]) replaceIdx(
+	idx int8,
+	elem T,
+	left, right *node[T],
+	edit *atomic.Bool,
+) nodeReturn[T] {
+	center := n
+	if n.isEditable() {
+		n.keys[idx] = elem
+		if idx < n.len-1 {
+			return nodeReturn[T]{status: returnEarly}
+		}
+	} else {
+		center = newLeaf[T](n.len, edit)
+		copy(center.keys, n.keys[:n.len])
+		center.keys[idx] = elem
+	}
+	return nodeReturn[T]{
+		status: returnThree,
+		nodes: [...]*node[T]{
+			left,
+			center.asNode(),
+			right,
+		},
+	}
+}
+
 func (n *leafNode[T]) copyAndRemoveIdx(
 	idx, newLen int8,
 	left, right *node[T],
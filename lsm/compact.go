@@ -0,0 +1,287 @@
+package lsm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+// The manifest lists the live runs so that a DB can be reopened. Its
+// first line is "next N", the number of the next run file, and each
+// following line is "L name" for a run of level L, with the runs of
+// level 0 listed newest first. It is replaced atomically by renaming.
+const manifestName = "MANIFEST"
+
+// background flushes memtables and compacts levels until the DB is
+// closed. Flushes take priority so that writers are not stalled
+// longer than one compaction step.
+func (db *DB) background() {
+	defer db.wg.Done()
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-db.work:
+		}
+		for {
+			select {
+			case <-db.stop:
+				return
+			default:
+			}
+			more, err := db.step()
+			if err != nil {
+				db.mu.Lock()
+				db.err = err
+				db.cond.Broadcast()
+				db.mu.Unlock()
+				return
+			}
+			if !more {
+				break
+			}
+		}
+	}
+}
+
+// step does one unit of background work and reports whether there
+// may be more.
+func (db *DB) step() (bool, error) {
+	db.mu.RLock()
+	imm := db.imm
+	level := db.compactionLevel()
+	db.mu.RUnlock()
+	switch {
+	case imm != nil:
+		return true, db.flushImm(imm)
+	case level >= 0:
+		return true, db.compact(level)
+	}
+	return false, nil
+}
+
+// flushImm writes the immutable memtable to a new run of level 0.
+func (db *DB) flushImm(imm *treemap.Map[string, entry]) error {
+	w, err := db.createRun()
+	if err != nil {
+		return err
+	}
+	for key, e := range imm.All() {
+		if err := w.add([]byte(key), e); err != nil {
+			return w.abort(err)
+		}
+	}
+	r, err := w.finish(db.opts.FalsePositiveRate)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ensureLevels(1)
+	db.levels[0] = append([]*run{r}, db.levels[0]...)
+	db.imm = nil
+	db.cond.Broadcast()
+	return db.saveManifest()
+}
+
+// compactionLevel returns the level whose runs should be merged into
+// the next one, or -1 if none should.
+func (db *DB) compactionLevel() int {
+	if len(db.levels) > 0 && len(db.levels[0]) >= db.opts.L0Runs {
+		return 0
+	}
+	limit := int64(db.opts.MemtableSize)
+	for i := 1; i < len(db.levels); i++ {
+		limit *= int64(db.opts.LevelRatio)
+		var size int64
+		for _, r := range db.levels[i] {
+			size += r.size
+		}
+		if size > limit {
+			return i
+		}
+	}
+	return -1
+}
+
+// compact merges the runs of level into the next level. Tombstones
+// are dropped once nothing older can be hidden by them.
+func (db *DB) compact(level int) error {
+	db.mu.RLock()
+	inputs := append([]*run(nil), db.levels[level]...)
+	if level+1 < len(db.levels) {
+		inputs = append(inputs, db.levels[level+1]...)
+	}
+	deepest := true
+	for _, l := range db.levels[min(level+2, len(db.levels)):] {
+		deepest = deepest && len(l) == 0
+	}
+	db.mu.RUnlock()
+
+	var sources []source
+	for _, r := range inputs {
+		it, err := r.iter(nil)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, it)
+	}
+	w, err := db.createRun()
+	if err != nil {
+		return err
+	}
+	m := newMerger(sources)
+	var n int
+	for {
+		key, e, ok, err := m.next()
+		if err != nil {
+			return w.abort(err)
+		}
+		if !ok {
+			break
+		}
+		if e.tombstone && deepest {
+			continue
+		}
+		if err := w.add(key, e); err != nil {
+			return w.abort(err)
+		}
+		n++
+	}
+	var out []*run
+	if n > 0 {
+		r, err := w.finish(db.opts.FalsePositiveRate)
+		if err != nil {
+			return err
+		}
+		out = []*run{r}
+	} else {
+		w.abort(nil)
+	}
+
+	db.mu.Lock()
+	db.ensureLevels(level + 2)
+	db.levels[level] = nil
+	db.levels[level+1] = out
+	db.cond.Broadcast()
+	err = db.saveManifest()
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, r := range inputs {
+		r.obsolete.Store(true)
+		r.unref()
+	}
+	return nil
+}
+
+func (db *DB) ensureLevels(n int) {
+	for len(db.levels) < n {
+		db.levels = append(db.levels, nil)
+	}
+}
+
+func (db *DB) createRun() (*runWriter, error) {
+	db.mu.Lock()
+	name := fmt.Sprintf("%06d.run", db.nextFile)
+	db.nextFile++
+	db.mu.Unlock()
+	return createRun(filepath.Join(db.dir, name), db.opts.BlockSize)
+}
+
+// saveManifest records the live runs. It must be called with mu held.
+func (db *DB) saveManifest() error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "next %d\n", db.nextFile)
+	for level, runs := range db.levels {
+		for _, r := range runs {
+			fmt.Fprintf(&b, "%d %s\n", level, filepath.Base(r.path))
+		}
+	}
+	tmp := filepath.Join(db.dir, manifestName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(db.dir, manifestName))
+}
+
+// load opens the runs listed in the manifest and removes run files
+// left behind by an interrupted flush or compaction.
+func (db *DB) load() error {
+	if err := os.MkdirAll(db.dir, 0o755); err != nil {
+		return err
+	}
+	live := make(map[string]bool)
+	f, err := os.Open(filepath.Join(db.dir, manifestName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			first, second, ok := strings.Cut(s.Text(), " ")
+			n, err := strconv.Atoi(second)
+			if first == "next" && ok && err == nil {
+				db.nextFile = n
+				continue
+			}
+			level, err := strconv.Atoi(first)
+			if !ok || err != nil || level < 0 ||
+				filepath.Base(second) != second {
+				db.closeRuns()
+				return ErrCorrupt
+			}
+			r, err := openRun(filepath.Join(db.dir, second))
+			if err != nil {
+				db.closeRuns()
+				return err
+			}
+			db.ensureLevels(level + 1)
+			db.levels[level] = append(db.levels[level], r)
+			live[second] = true
+		}
+		if err := s.Err(); err != nil {
+			db.closeRuns()
+			return err
+		}
+	}
+	names, err := filepath.Glob(filepath.Join(db.dir, "*.run"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !live[filepath.Base(name)] {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
+
+func (db *DB) closeRuns() {
+	for _, level := range db.levels {
+		for _, r := range level {
+			r.unref()
+		}
+	}
+	db.levels = nil
+}
@@ -0,0 +1,276 @@
+// Package lsm implements a write-optimized embedded key-value store
+// built as a log-structured merge tree. Writes go to an in-memory
+// memtable, a treemap.TMap, which is flushed to an immutable sorted
+// run file once it grows past a size threshold. Each run has a sparse
+// index of its blocks and a bloom filter of its keys, so reading a
+// key costs at most one block read per run. Runs are merged in the
+// background into levels of growing size.
+//
+// Writes that have not been flushed are lost if the process exits
+// without calling Flush or Close.
+package lsm
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+const (
+	// ErrNotFound is returned by Get for keys with no value.
+	ErrNotFound = Error("key not found")
+	// ErrClosed is returned when using a closed DB.
+	ErrClosed = Error("db is closed")
+	// ErrCorrupt is returned when a run file or the manifest cannot
+	// be decoded.
+	ErrCorrupt = Error("corrupt db file")
+)
+
+// Options tunes a DB. Zero fields take their default.
+type Options struct {
+	// MemtableSize is the approximate size in bytes at which the
+	// memtable is flushed to a run. It defaults to 4 MiB.
+	MemtableSize int
+	// BlockSize is the size in bytes of the blocks of a run, the unit
+	// of its sparse index. It defaults to 4 KiB.
+	BlockSize int
+	// FalsePositiveRate is the false positive rate of the bloom
+	// filter of each run. It defaults to 0.01.
+	FalsePositiveRate float64
+	// L0Runs is the number of runs flushed to level 0 that triggers
+	// their compaction into level 1. It defaults to 4.
+	L0Runs int
+	// LevelRatio is the factor by which the size of each level may
+	// exceed that of the one before. Level 1 may hold LevelRatio
+	// memtables. It defaults to 10.
+	LevelRatio int
+}
+
+func (o *Options) withDefaults() Options {
+	var out Options
+	if o != nil {
+		out = *o
+	}
+	if out.MemtableSize <= 0 {
+		out.MemtableSize = 4 << 20
+	}
+	if out.BlockSize <= 0 {
+		out.BlockSize = 4 << 10
+	}
+	if out.FalsePositiveRate <= 0 {
+		out.FalsePositiveRate = 0.01
+	}
+	if out.L0Runs <= 0 {
+		out.L0Runs = 4
+	}
+	if out.LevelRatio <= 1 {
+		out.LevelRatio = 10
+	}
+	return out
+}
+
+// entryOverhead approximates the memory used by a memtable entry
+// beyond its key and value.
+const entryOverhead = 48
+
+// DB is a log-structured merge tree stored in a directory. A DB may be
+// used from several goroutines at once.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu   sync.RWMutex
+	cond *sync.Cond
+	// mem takes the writes. Once full it becomes imm, which is
+	// read alongside it until the background goroutine has
+	// flushed it to a run.
+	mem     *treemap.TMap[string, entry]
+	memSize int
+	imm     *treemap.Map[string, entry]
+	// levels[0] holds the flushed runs, newest first, and every
+	// deeper level holds at most one run.
+	levels   [][]*run
+	nextFile int
+	err      error
+	closed   bool
+
+	work chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func emptyMemtable() *treemap.TMap[string, entry] {
+	return treemap.Empty[string, entry](strings.Compare,
+		func(a, b entry) bool {
+			return a.tombstone == b.tombstone &&
+				bytes.Equal(a.value, b.value)
+		}).AsTransient()
+}
+
+// Open opens the DB stored in dir, creating it if needed. opts may be
+// nil to use the defaults.
+func Open(dir string, opts *Options) (*DB, error) {
+	db := &DB{
+		dir:  dir,
+		opts: opts.withDefaults(),
+		mem:  emptyMemtable(),
+		work: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+	db.cond = sync.NewCond(&db.mu)
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	db.wg.Add(1)
+	go db.background()
+	return db, nil
+}
+
+// Put sets the value of key. The DB keeps its own copies of key and
+// value. Put blocks while the background goroutine catches up with
+// flushes and compactions.
+func (db *DB) Put(key, value []byte) error {
+	return db.write(key, entry{value: bytes.Clone(value)})
+}
+
+// Delete removes key. Deletes are recorded as tombstones that hide
+// older values until compaction reaches the deepest level.
+func (db *DB) Delete(key []byte) error {
+	return db.write(key, entry{tombstone: true})
+}
+
+func (db *DB) write(key []byte, e entry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for db.stalled() && db.err == nil && !db.closed {
+		db.cond.Wait()
+	}
+	if err := db.usable(); err != nil {
+		return err
+	}
+	db.mem.Assoc(string(key), e)
+	db.memSize += len(key) + len(e.value) + entryOverhead
+	if db.memSize >= db.opts.MemtableSize && db.imm == nil {
+		db.rotate()
+	}
+	return nil
+}
+
+// stalled reports whether writes must wait for the background
+// goroutine, either to flush the previous memtable or to compact
+// level 0 if flushes have outpaced compaction.
+func (db *DB) stalled() bool {
+	return db.imm != nil && db.memSize >= db.opts.MemtableSize ||
+		len(db.levels) > 0 && len(db.levels[0]) >= 2*db.opts.L0Runs
+}
+
+// rotate hands the memtable to the background goroutine to flush.
+func (db *DB) rotate() {
+	db.imm = db.mem.AsPersistent()
+	db.mem = emptyMemtable()
+	db.memSize = 0
+	db.signal()
+}
+
+func (db *DB) signal() {
+	select {
+	case db.work <- struct{}{}:
+	default:
+	}
+}
+
+func (db *DB) usable() error {
+	if db.closed {
+		return ErrClosed
+	}
+	return db.err
+}
+
+// Get returns the value of key, or ErrNotFound if it has none. The
+// memtables are read first and then the runs from newest to oldest;
+// the first entry found decides.
+func (db *DB) Get(key []byte) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if err := db.usable(); err != nil {
+		return nil, err
+	}
+	e, ok, err := db.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || e.tombstone {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(e.value), nil
+}
+
+func (db *DB) lookup(key []byte) (entry, bool, error) {
+	if e, ok := db.mem.Find(string(key)); ok {
+		return e, true, nil
+	}
+	if db.imm != nil {
+		if e, ok := db.imm.Find(string(key)); ok {
+			return e, true, nil
+		}
+	}
+	for _, level := range db.levels {
+		for _, r := range level {
+			if e, ok, err := r.get(key); ok || err != nil {
+				return e, ok, err
+			}
+		}
+	}
+	return entry{}, false, nil
+}
+
+// Flush writes the memtable to a run and waits for it to be durable.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.flushLocked()
+}
+
+func (db *DB) flushLocked() error {
+	for db.imm != nil && db.err == nil {
+		db.cond.Wait()
+	}
+	if err := db.usable(); err != nil {
+		return err
+	}
+	if db.memSize > 0 {
+		db.rotate()
+	}
+	for db.imm != nil && db.err == nil {
+		db.cond.Wait()
+	}
+	return db.err
+}
+
+// Close flushes the memtable, stops background compaction and closes
+// the DB.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	err := db.flushLocked()
+	db.closed = true
+	db.cond.Broadcast()
+	db.mu.Unlock()
+	close(db.stop)
+	db.wg.Wait()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closeRuns()
+	return err
+}
@@ -0,0 +1,141 @@
+package lsm_test
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree/lsm"
+)
+
+var smallOptions = &lsm.Options{
+	MemtableSize: 2 << 10,
+	BlockSize:    256,
+	L0Runs:       2,
+	LevelRatio:   4,
+}
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key%06d", i))
+}
+
+// check verifies that db holds exactly the entries of model.
+func check(t *testing.T, db *lsm.DB, model map[string]string) {
+	t.Helper()
+	for i := 0; i < 3000; i++ {
+		v, err := db.Get(key(i))
+		want, ok := model[string(key(i))]
+		switch {
+		case ok && (err != nil || string(v) != want):
+			t.Fatalf("got %q, %v for %s expected %q", v, err, key(i), want)
+		case !ok && !errors.Is(err, lsm.ErrNotFound):
+			t.Fatalf("got %q, %v for deleted %s", v, err, key(i))
+		}
+	}
+	var got []string
+	it := db.Scan(nil, nil)
+	for it.HasNext() {
+		k, v := it.Next()
+		if model[string(k)] != string(v) {
+			t.Fatalf("scan got %q=%q expected %q", k, v, model[string(k)])
+		}
+		got = append(got, string(k))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := slices.Sorted(maps.Keys(model)); !slices.Equal(got, want) {
+		t.Fatalf("scan got %v keys expected %v", len(got), len(want))
+	}
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := lsm.Open(dir, smallOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[string]string{}
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 20000; n++ {
+		k := key(rng.Intn(3000))
+		if rng.Intn(4) == 0 {
+			delete(model, string(k))
+			err = db.Delete(k)
+		} else {
+			v := fmt.Sprintf("value%d", n)
+			model[string(k)] = v
+			err = db.Put(k, []byte(v))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	runs, _ := filepath.Glob(filepath.Join(dir, "*.run"))
+	if len(runs) > 10 {
+		t.Fatalf("got %v runs, expected compaction to merge them", len(runs))
+	}
+
+	db, err = lsm.Open(dir, smallOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(t, db, model)
+}
+
+func TestScanSnapshot(t *testing.T) {
+	db, err := lsm.Open(t.TempDir(), smallOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		db.Put(key(i), []byte("old"))
+	}
+	it := db.Scan(key(100), key(200))
+	defer it.Close()
+	for i := 0; i < 1000; i++ {
+		db.Put(key(i), []byte("new"))
+		db.Delete(key(i + 1))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	n := 100
+	for it.HasNext() {
+		k, v := it.Next()
+		if string(k) != string(key(n)) || string(v) != "old" {
+			t.Fatalf("got %s=%s expected %s=old", k, v, key(n))
+		}
+		n++
+	}
+	if it.Err() != nil || n != 200 {
+		t.Fatalf("scan stopped at %v: %v", n, it.Err())
+	}
+}
+
+func TestClosed(t *testing.T) {
+	db, err := lsm.Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("a"), []byte("b"))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("a"), []byte("c")); !errors.Is(err, lsm.ErrClosed) {
+		t.Fatalf("got %v expected %v", err, lsm.ErrClosed)
+	}
+	if _, err := db.Get([]byte("a")); !errors.Is(err, lsm.ErrClosed) {
+		t.Fatalf("got %v expected %v", err, lsm.ErrClosed)
+	}
+}
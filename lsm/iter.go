@@ -0,0 +1,176 @@
+package lsm
+
+import (
+	"bytes"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+// source yields entries in key order.
+type source interface {
+	next() ([]byte, entry, bool, error)
+}
+
+type memSource struct {
+	it treemap.Iterator[string, entry]
+}
+
+func (s *memSource) next() ([]byte, entry, bool, error) {
+	if !s.it.HasNext() {
+		return nil, entry{}, false, nil
+	}
+	key, e := s.it.Next()
+	return []byte(key), e, true, nil
+}
+
+// merger merges sources given newest first. When several sources hold
+// the same key the entry of the newest one is returned and the others
+// are skipped.
+type merger struct {
+	sources []source
+	heads   []head
+}
+
+type head struct {
+	key []byte
+	e   entry
+	ok  bool
+}
+
+func newMerger(sources []source) *merger {
+	return &merger{sources: sources}
+}
+
+func (m *merger) advance(i int) error {
+	key, e, ok, err := m.sources[i].next()
+	m.heads[i] = head{key: key, e: e, ok: ok}
+	return err
+}
+
+func (m *merger) next() ([]byte, entry, bool, error) {
+	if m.heads == nil {
+		m.heads = make([]head, len(m.sources))
+		for i := range m.sources {
+			if err := m.advance(i); err != nil {
+				return nil, entry{}, false, err
+			}
+		}
+	}
+	best := -1
+	for i, h := range m.heads {
+		if h.ok && (best < 0 || bytes.Compare(h.key, m.heads[best].key) < 0) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, entry{}, false, nil
+	}
+	key, e := m.heads[best].key, m.heads[best].e
+	for i, h := range m.heads {
+		if h.ok && bytes.Equal(h.key, key) {
+			if err := m.advance(i); err != nil {
+				return nil, entry{}, false, err
+			}
+		}
+	}
+	return key, e, true, nil
+}
+
+// Scan returns an iterator over the keys in [lo, hi) and their values,
+// in order. A nil lo or hi leaves that end unbounded. The iterator
+// sees the DB as it was when Scan was called.
+func (db *DB) Scan(lo, hi []byte) *Iterator {
+	db.mu.Lock()
+	if err := db.usable(); err != nil {
+		db.mu.Unlock()
+		return &Iterator{err: err}
+	}
+	// Freeze the memtable so the iterator can read it while writes
+	// carry on in a new transient sharing its nodes.
+	mem := db.mem.AsPersistent()
+	db.mem = mem.AsTransient()
+	maps := []*treemap.Map[string, entry]{mem}
+	if db.imm != nil {
+		maps = append(maps, db.imm)
+	}
+	var runs []*run
+	for _, level := range db.levels {
+		for _, r := range level {
+			r.ref()
+			runs = append(runs, r)
+		}
+	}
+	db.mu.Unlock()
+
+	it := &Iterator{hi: hi, runs: runs}
+	var sources []source
+	for _, m := range maps {
+		mi := m.Iterator()
+		if lo != nil {
+			mi = m.IteratorFrom(string(lo))
+		}
+		sources = append(sources, &memSource{it: mi})
+	}
+	for _, r := range runs {
+		ri, err := r.iter(lo)
+		if err != nil {
+			it.err = err
+			it.Close()
+			return it
+		}
+		sources = append(sources, ri)
+	}
+	it.m = newMerger(sources)
+	return it
+}
+
+// Iterator iterates over a snapshot of a DB. It keeps the runs it
+// reads open until it is exhausted or closed, so an iterator that is
+// not run to the end must be closed. If reading fails HasNext returns
+// false and Err reports the error.
+type Iterator struct {
+	m          *merger
+	hi         []byte
+	runs       []*run
+	key, value []byte
+	ready      bool
+	err        error
+}
+
+func (it *Iterator) HasNext() bool {
+	for !it.ready && it.err == nil && it.m != nil {
+		key, e, ok, err := it.m.next()
+		switch {
+		case err != nil:
+			it.err = err
+		case !ok || it.hi != nil && bytes.Compare(key, it.hi) >= 0:
+			it.Close()
+		case !e.tombstone:
+			it.key, it.value, it.ready = key, e.value, true
+		}
+	}
+	if !it.ready {
+		it.Close()
+	}
+	return it.ready
+}
+
+func (it *Iterator) Next() (key, value []byte) {
+	it.ready = false
+	return it.key, it.value
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close releases the runs held by the iterator. It is safe to call
+// more than once.
+func (it *Iterator) Close() {
+	for _, r := range it.runs {
+		r.unref()
+	}
+	it.runs = nil
+	it.m = nil
+}
@@ -0,0 +1,370 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"jsouthworth.net/go/btree/internal/bloom"
+)
+
+// A run file holds its records sorted by key and grouped into blocks,
+// followed by a sparse index holding the first key of every block, a
+// bloom filter of its keys and a fixed size footer locating them.
+//
+// A record is a kind byte, the key and, for puts, the value, with the
+// key and value each preceded by their length as a uvarint.
+const (
+	runMagic   = 0x31304e55524d534c // "LSMRUN01"
+	footerSize = 32
+)
+
+const (
+	recordPut byte = iota + 1
+	recordDelete
+)
+
+// entry is the latest write to a key, a tombstone for a delete.
+type entry struct {
+	value     []byte
+	tombstone bool
+}
+
+func hashKey(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// run is an open, immutable run file. Runs are reference counted so
+// that a run replaced by compaction stays readable by the iterators
+// still using it; the file is removed when the last reference goes.
+type run struct {
+	path     string
+	f        *os.File
+	size     int64
+	count    int
+	index    []block
+	filter   *bloom.Filter
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+type block struct {
+	first    []byte
+	off, len int64
+}
+
+func (r *run) ref() {
+	r.refs.Add(1)
+}
+
+func (r *run) unref() {
+	if r.refs.Add(-1) > 0 {
+		return
+	}
+	r.f.Close()
+	if r.obsolete.Load() {
+		os.Remove(r.path)
+	}
+}
+
+// get returns the entry for key, if the run has one.
+func (r *run) get(key []byte) (entry, bool, error) {
+	if !r.filter.MayContain(hashKey(key)) {
+		return entry{}, false, nil
+	}
+	i := sort.Search(len(r.index), func(i int) bool {
+		return bytes.Compare(r.index[i].first, key) > 0
+	}) - 1
+	if i < 0 {
+		return entry{}, false, nil
+	}
+	it := runIter{r: r, blk: i}
+	if err := it.load(); err != nil {
+		return entry{}, false, err
+	}
+	for {
+		k, e, ok, err := it.next()
+		if err != nil || !ok {
+			return entry{}, false, err
+		}
+		switch c := bytes.Compare(k, key); {
+		case c == 0:
+			return e, true, nil
+		case c > 0:
+			return entry{}, false, nil
+		}
+	}
+}
+
+// iter returns an iterator over the records of the run with keys at
+// least lo, or all of them if lo is nil.
+func (r *run) iter(lo []byte) (*runIter, error) {
+	it := &runIter{r: r}
+	if lo != nil {
+		it.blk = max(sort.Search(len(r.index), func(i int) bool {
+			return bytes.Compare(r.index[i].first, lo) > 0
+		})-1, 0)
+	}
+	if err := it.load(); err != nil {
+		return nil, err
+	}
+	it.lo = lo
+	return it, nil
+}
+
+// runIter reads the records of a run one block at a time.
+type runIter struct {
+	r   *run
+	blk int
+	buf []byte
+	lo  []byte
+}
+
+func (it *runIter) load() error {
+	if it.blk >= len(it.r.index) {
+		it.buf = nil
+		return nil
+	}
+	b := it.r.index[it.blk]
+	it.buf = make([]byte, b.len)
+	_, err := it.r.f.ReadAt(it.buf, b.off)
+	return err
+}
+
+func (it *runIter) next() ([]byte, entry, bool, error) {
+	for {
+		for len(it.buf) == 0 {
+			if it.blk >= len(it.r.index) {
+				return nil, entry{}, false, nil
+			}
+			it.blk++
+			if err := it.load(); err != nil {
+				return nil, entry{}, false, err
+			}
+		}
+		key, e, rest, err := decodeRecord(it.buf)
+		if err != nil {
+			return nil, entry{}, false, err
+		}
+		it.buf = rest
+		if it.lo != nil && bytes.Compare(key, it.lo) < 0 {
+			continue
+		}
+		it.lo = nil
+		return key, e, true, nil
+	}
+}
+
+func decodeRecord(b []byte) ([]byte, entry, []byte, error) {
+	if len(b) == 0 {
+		return nil, entry{}, nil, ErrCorrupt
+	}
+	kind := b[0]
+	key, b, ok := decodeBytes(b[1:])
+	if !ok {
+		return nil, entry{}, nil, ErrCorrupt
+	}
+	switch kind {
+	case recordDelete:
+		return key, entry{tombstone: true}, b, nil
+	case recordPut:
+		value, b, ok := decodeBytes(b)
+		if !ok {
+			return nil, entry{}, nil, ErrCorrupt
+		}
+		return key, entry{value: value}, b, nil
+	}
+	return nil, entry{}, nil, ErrCorrupt
+}
+
+func decodeBytes(b []byte) ([]byte, []byte, bool) {
+	n, sz := binary.Uvarint(b)
+	if sz <= 0 || uint64(len(b)-sz) < n {
+		return nil, nil, false
+	}
+	b = b[sz:]
+	return b[:n:n], b[n:], true
+}
+
+// openRun opens the run file at path and loads its index and filter.
+func openRun(path string) (*run, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := loadRun(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.path = path
+	r.ref()
+	return r, nil
+}
+
+func loadRun(f *os.File) (*run, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < footerSize {
+		return nil, ErrCorrupt
+	}
+	var footer [footerSize]byte
+	if _, err := f.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+	indexOff := int64(binary.LittleEndian.Uint64(footer[0:]))
+	filterOff := int64(binary.LittleEndian.Uint64(footer[8:]))
+	count := binary.LittleEndian.Uint64(footer[16:])
+	if binary.LittleEndian.Uint64(footer[24:]) != runMagic ||
+		indexOff < 0 || indexOff > filterOff || filterOff > size-footerSize {
+		return nil, ErrCorrupt
+	}
+	meta := make([]byte, size-footerSize-indexOff)
+	if _, err := f.ReadAt(meta, indexOff); err != nil {
+		return nil, err
+	}
+	r := &run{f: f, size: size, count: int(count)}
+	b := meta[:filterOff-indexOff]
+	for len(b) > 0 {
+		first, rest, ok := decodeBytes(b)
+		if !ok {
+			return nil, ErrCorrupt
+		}
+		off, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return nil, ErrCorrupt
+		}
+		r.index = append(r.index, block{first: first, off: int64(off)})
+		b = rest[n:]
+	}
+	for i := range r.index {
+		end := indexOff
+		if i+1 < len(r.index) {
+			end = r.index[i+1].off
+		}
+		r.index[i].len = end - r.index[i].off
+		if r.index[i].len < 0 {
+			return nil, ErrCorrupt
+		}
+	}
+	r.filter, _, err = bloom.Decode(meta[filterOff-indexOff:])
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return r, nil
+}
+
+// runWriter writes a run file from records added in key order.
+type runWriter struct {
+	path      string
+	f         *os.File
+	w         *bufio.Writer
+	off       int64
+	blockSize int
+	block     []byte
+	first     []byte
+	index     []block
+	hashes    []uint64
+}
+
+func createRun(path string, blockSize int) (*runWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &runWriter{
+		path:      path,
+		f:         f,
+		w:         bufio.NewWriter(f),
+		blockSize: blockSize,
+	}, nil
+}
+
+func (w *runWriter) add(key []byte, e entry) error {
+	if len(w.block) == 0 {
+		w.first = bytes.Clone(key)
+	}
+	if e.tombstone {
+		w.block = append(w.block, recordDelete)
+		w.block = appendBytes(w.block, key)
+	} else {
+		w.block = append(w.block, recordPut)
+		w.block = appendBytes(w.block, key)
+		w.block = appendBytes(w.block, e.value)
+	}
+	w.hashes = append(w.hashes, hashKey(key))
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func (w *runWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	w.index = append(w.index, block{first: w.first, off: w.off})
+	n, err := w.w.Write(w.block)
+	w.off += int64(n)
+	w.block = w.block[:0]
+	return err
+}
+
+// finish completes the file, syncs it and returns it opened as a run.
+func (w *runWriter) finish(fpRate float64) (*run, error) {
+	if err := w.flushBlock(); err != nil {
+		return nil, w.abort(err)
+	}
+	var meta []byte
+	for _, b := range w.index {
+		meta = appendBytes(meta, b.first)
+		meta = binary.AppendUvarint(meta, uint64(b.off))
+	}
+	filterOff := w.off + int64(len(meta))
+	filter := bloom.New(len(w.hashes), fpRate)
+	for _, h := range w.hashes {
+		filter.Add(h)
+	}
+	meta = filter.AppendBinary(meta)
+	meta = binary.LittleEndian.AppendUint64(meta, uint64(w.off))
+	meta = binary.LittleEndian.AppendUint64(meta, uint64(filterOff))
+	meta = binary.LittleEndian.AppendUint64(meta, uint64(len(w.hashes)))
+	meta = binary.LittleEndian.AppendUint64(meta, runMagic)
+	if _, err := w.w.Write(meta); err != nil {
+		return nil, w.abort(err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return nil, w.abort(err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return nil, w.abort(err)
+	}
+	r, err := loadRun(w.f)
+	if err != nil {
+		return nil, w.abort(err)
+	}
+	r.path = w.path
+	r.ref()
+	return r, nil
+}
+
+// abort removes the partly written file and returns err.
+func (w *runWriter) abort(err error) error {
+	w.f.Close()
+	os.Remove(w.path)
+	return err
+}
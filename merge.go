@@ -0,0 +1,216 @@
+package btree
+
+import (
+	"iter"
+)
+
+// mergeInline is the number of iterators a MergeIterator holds
+// without allocating.
+const mergeInline = 4
+
+// MergeIterator yields the elements of several ordered iterators as a
+// single ordered stream. It is created by Merge or MergeFunc and, like
+// Iterator, may be used without allocating when merging up to four
+// iterators.
+type MergeIterator[T any] struct {
+	cmp     compareFunc[T]
+	combine func(a, b T) T
+
+	// The iterators are kept in inline while there are few enough of
+	// them and in spill otherwise. The first hlen entries of hinline
+	// or hspill are a heap of the indexes of the iterators that are
+	// not exhausted, ordered by their next element.
+	n       int
+	inline  [mergeInline]Iterator[T]
+	spill   []Iterator[T]
+	hinline [mergeInline]int
+	hspill  []int
+	hlen    int
+}
+
+// Merge returns an iterator yielding every element of iters in the
+// order given by cmp. Each of iters must already be ordered by cmp.
+// Equal elements are all kept and yielded in the order of the
+// iterators they came from.
+func Merge[T any](cmp func(a, b T) int, iters ...Iterator[T]) MergeIterator[T] {
+	return MergeFunc(cmp, nil, iters...)
+}
+
+// MergeFunc is like Merge but equal elements from different iterators
+// are yielded once, folded together with combine in the order of the
+// iterators they came from. Passing KeepFirst keeps the element from
+// the first iterator. A nil combine keeps every element.
+func MergeFunc[T any](
+	cmp func(a, b T) int,
+	combine func(a, b T) T,
+	iters ...Iterator[T],
+) MergeIterator[T] {
+	m := MergeIterator[T]{
+		cmp:     cmp,
+		combine: combine,
+		n:       len(iters),
+	}
+	if len(iters) > mergeInline {
+		m.spill = make([]Iterator[T], len(iters))
+		m.hspill = make([]int, len(iters))
+	}
+	its, h := m.iters(), m.heap()
+	copy(its, iters)
+	for i := range its {
+		if its[i].HasNext() {
+			h[m.hlen] = i
+			m.hlen++
+		}
+	}
+	for i := m.hlen/2 - 1; i >= 0; i-- {
+		m.down(i)
+	}
+	return m
+}
+
+// KeepFirst may be passed to MergeFunc to keep the first of several
+// equal elements.
+func KeepFirst[T any](a, b T) T {
+	return a
+}
+
+func (m *MergeIterator[T]) HasNext() bool {
+	return m.hlen > 0
+}
+
+func (m *MergeIterator[T]) Next() T {
+	out := m.pop()
+	if m.combine == nil {
+		return out
+	}
+	its, h := m.iters(), m.heap()
+	for m.hlen > 0 && m.cmp(its[h[0]].peek(), out) == 0 {
+		out = m.combine(out, m.pop())
+	}
+	return out
+}
+
+func (m *MergeIterator[T]) Seq(yield func(T) bool) {
+	for m.HasNext() {
+		if !yield(m.Next()) {
+			break
+		}
+	}
+}
+
+func (m *MergeIterator[T]) iters() []Iterator[T] {
+	if m.spill != nil {
+		return m.spill
+	}
+	return m.inline[:m.n]
+}
+
+func (m *MergeIterator[T]) heap() []int {
+	if m.hspill != nil {
+		return m.hspill
+	}
+	return m.hinline[:m.n]
+}
+
+// pop returns the next element of the iterator at the top of the heap
+// and restores the heap.
+func (m *MergeIterator[T]) pop() T {
+	its, h := m.iters(), m.heap()
+	top := &its[h[0]]
+	out := top.Next()
+	if !top.HasNext() {
+		m.hlen--
+		h[0] = h[m.hlen]
+	}
+	m.down(0)
+	return out
+}
+
+func (m *MergeIterator[T]) less(a, b int) bool {
+	its := m.iters()
+	c := m.cmp(its[a].peek(), its[b].peek())
+	return c < 0 || c == 0 && a < b
+}
+
+func (m *MergeIterator[T]) down(i int) {
+	siftDown(m.heap()[:m.hlen], i, m.less)
+}
+
+// siftDown moves the i'th element of the heap h down until neither of
+// its children is less than it.
+func siftDown(h []int, i int, less func(a, b int) bool) {
+	for {
+		least := i
+		for _, child := range [2]int{2*i + 1, 2*i + 2} {
+			if child < len(h) && less(h[child], h[least]) {
+				least = child
+			}
+		}
+		if least == i {
+			return
+		}
+		h[i], h[least] = h[least], h[i]
+		i = least
+	}
+}
+
+// MergeSeq is like Merge for sequences. Each of seqs must already be
+// ordered by cmp.
+func MergeSeq[T any](cmp func(a, b T) int, seqs ...iter.Seq[T]) iter.Seq[T] {
+	return MergeSeqFunc(cmp, nil, seqs...)
+}
+
+// MergeSeqFunc is like MergeFunc for sequences.
+func MergeSeqFunc[T any](
+	cmp func(a, b T) int,
+	combine func(a, b T) T,
+	seqs ...iter.Seq[T],
+) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		type source struct {
+			head T
+			next func() (T, bool)
+		}
+		srcs := make([]source, 0, len(seqs))
+		for _, seq := range seqs {
+			next, stop := iter.Pull(seq)
+			defer stop()
+			if head, ok := next(); ok {
+				srcs = append(srcs, source{head: head, next: next})
+			}
+		}
+		less := func(a, b int) bool {
+			c := cmp(srcs[a].head, srcs[b].head)
+			return c < 0 || c == 0 && a < b
+		}
+		h := make([]int, len(srcs))
+		for i := range h {
+			h[i] = i
+		}
+		for i := len(h)/2 - 1; i >= 0; i-- {
+			siftDown(h, i, less)
+		}
+		pop := func() T {
+			src := &srcs[h[0]]
+			out := src.head
+			if head, ok := src.next(); ok {
+				src.head = head
+			} else {
+				h[0] = h[len(h)-1]
+				h = h[:len(h)-1]
+			}
+			siftDown(h, 0, less)
+			return out
+		}
+		for len(h) > 0 {
+			out := pop()
+			for combine != nil && len(h) > 0 &&
+				cmp(srcs[h[0]].head, out) == 0 {
+				out = combine(out, pop())
+			}
+			if !yield(out) {
+				return
+			}
+		}
+	}
+}
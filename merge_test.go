@@ -0,0 +1,130 @@
+package btree_test
+
+import (
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+)
+
+func TestMerge(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	shards := gen.SliceOf(gen.SliceOf(gen.IntRange(0, 200)))
+	properties.Property("Merge keeps every element in order",
+		prop.ForAll(
+			func(parts [][]int) bool {
+				var iters []btree.Iterator[int]
+				var seqs []iter.Seq[int]
+				var expected []int
+				for _, part := range parts {
+					tree := buildTree(part)
+					iters = append(iters, tree.Iterator())
+					seqs = append(seqs, tree.All())
+					expected = append(expected, slices.Collect(tree.All())...)
+				}
+				slices.Sort(expected)
+				m := btree.Merge(compare[int], iters...)
+				var got []int
+				for m.HasNext() {
+					got = append(got, m.Next())
+				}
+				var gotSeq []int
+				for elem := range btree.MergeSeq(compare[int], seqs...) {
+					gotSeq = append(gotSeq, elem)
+				}
+				return slices.Equal(got, expected) &&
+					slices.Equal(gotSeq, expected)
+			},
+			shards,
+		))
+	properties.Property("MergeFunc combines equal elements",
+		prop.ForAll(
+			func(parts [][]int) bool {
+				type counted struct{ elem, n int }
+				cmp := func(a, b counted) int {
+					return compare(a.elem, b.elem)
+				}
+				counts := map[int]int{}
+				var iters []btree.Iterator[counted]
+				for _, part := range parts {
+					tree := btree.Empty(cmp,
+						func(a, b counted) bool { return a == b })
+					for _, elem := range part {
+						tree = tree.Add(counted{elem, 1})
+					}
+					for c := range tree.All() {
+						counts[c.elem]++
+					}
+					iters = append(iters, tree.Iterator())
+				}
+				m := btree.MergeFunc(cmp, func(a, b counted) counted {
+					return counted{a.elem, a.n + b.n}
+				}, iters...)
+				prev := -1
+				for m.HasNext() {
+					c := m.Next()
+					if c.elem <= prev || counts[c.elem] != c.n {
+						return false
+					}
+					prev = c.elem
+					delete(counts, c.elem)
+				}
+				return len(counts) == 0
+			},
+			shards,
+		))
+	properties.TestingRun(t)
+}
+
+func TestMergeKeepFirst(t *testing.T) {
+	type pair struct{ key, src int }
+	cmp := func(a, b pair) int { return compare(a.key, b.key) }
+	var seqs [][]pair
+	for src := 0; src < 6; src++ {
+		var part []pair
+		for key := src; key < 20; key += 2 {
+			part = append(part, pair{key, src})
+		}
+		seqs = append(seqs, part)
+	}
+	expected := map[int]int{}
+	for key := 0; key < 20; key++ {
+		expected[key] = key % 2
+	}
+	m := btree.MergeSeqFunc(cmp, btree.KeepFirst[pair],
+		slices.Values(seqs[0]), slices.Values(seqs[1]),
+		slices.Values(seqs[2]), slices.Values(seqs[3]),
+		slices.Values(seqs[4]), slices.Values(seqs[5]))
+	var n int
+	for p := range m {
+		if p.key != n || p.src != expected[p.key] {
+			t.Fatalf("got %v expected key %v from %v",
+				p, n, expected[n])
+		}
+		n++
+	}
+	if n != 20 {
+		t.Fatalf("got %v keys expected 20", n)
+	}
+}
+
+func TestMergeAllocs(t *testing.T) {
+	a := buildTree([]int{1, 4, 7})
+	b := buildTree([]int{2, 5, 8})
+	c := buildTree([]int{3, 6, 9})
+	allocs := testing.AllocsPerRun(100, func() {
+		m := btree.MergeFunc(compare[int], btree.KeepFirst[int],
+			a.Iterator(), b.Iterator(), c.Iterator())
+		for m.HasNext() {
+			m.Next()
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("got %v allocations expected 0", allocs)
+	}
+}
@@ -0,0 +1,292 @@
+package btree
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Event is a kind of work done on the nodes of a tree while it is
+// edited.
+type Event uint8
+
+const (
+	// EventAlloc is a node being allocated. Every other event
+	// that produces new nodes is accompanied by one EventAlloc
+	// per node.
+	EventAlloc Event = iota
+	// EventCopy is a node being copied to apply an edit because
+	// it is shared with a persistent tree.
+	EventCopy
+	// EventInPlace is a node owned by a transient being edited
+	// without copying it.
+	EventInPlace
+	// EventSplit is a full node being split in two.
+	EventSplit
+	// EventMerge is an underfull node being joined with a
+	// sibling.
+	EventMerge
+	// EventBorrow is an underfull node taking elements from a
+	// sibling.
+	EventBorrow
+
+	numEvents
+)
+
+var eventNames = [numEvents]string{
+	EventAlloc:   "alloc",
+	EventCopy:    "copy",
+	EventInPlace: "in_place",
+	EventSplit:   "split",
+	EventMerge:   "merge",
+	EventBorrow:  "borrow",
+}
+
+func (e Event) String() string {
+	if e < numEvents {
+		return eventNames[e]
+	}
+	return fmt.Sprintf("Event(%d)", e)
+}
+
+// Observer is notified of the work done on the nodes of a tree while
+// it is edited; leaf is set if the node is a leaf. Observe is called
+// synchronously by the goroutine making the edit, once the edit is
+// done, so it should be cheap.
+//
+// The events are worked out by comparing the nodes on the path of
+// the edit before and after it, so the nodes themselves know nothing
+// of observers and trees without one pay nothing for them. With an
+// observer installed each edit of a transient also copies the nodes
+// it may change in place beforehand.
+type Observer interface {
+	Observe(e Event, leaf bool)
+}
+
+// WithObserver returns a tree holding the same elements as t that
+// reports the work done by its edits, and the edits of the trees and
+// transients derived from it, to obs. Install it when the tree is
+// created, for example
+//
+//	btree.Empty(cmp, eq).WithObserver(obs)
+//
+// so that every edit is observed.
+func (t *BTree[T]) WithObserver(obs Observer) *BTree[T] {
+	out := *t
+	out.obs = obs
+	return &out
+}
+
+// Counters is an Observer that counts the events of each kind,
+// separately for leaves and internal nodes. It may be shared by
+// several trees and used from several goroutines at once. Counters
+// implements expvar.Var, so it may be published with expvar.Publish.
+type Counters struct {
+	counts [numEvents][2]atomic.Int64
+}
+
+func (c *Counters) Observe(e Event, leaf bool) {
+	c.counts[e][leafIndex(leaf)].Add(1)
+}
+
+// Count returns the number of events of kind e observed on leaves, if
+// leaf is set, or on internal nodes.
+func (c *Counters) Count(e Event, leaf bool) int64 {
+	return c.counts[e][leafIndex(leaf)].Load()
+}
+
+// String returns the counts as a JSON object keyed by event, each
+// holding the counts for leaves and internal nodes.
+func (c *Counters) String() string {
+	var b strings.Builder
+	b.WriteRune('{')
+	for e := range numEvents {
+		if e > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: {\"leaf\": %d, \"internal\": %d}",
+			e, c.Count(e, true), c.Count(e, false))
+	}
+	b.WriteRune('}')
+	return b.String()
+}
+
+func leafIndex(leaf bool) int {
+	if leaf {
+		return 1
+	}
+	return 0
+}
+
+// observation holds what reporting the events of an edit needs to
+// know of a tree before the edit: its root and height, and a copy of
+// each node the edit may change in place.
+type observation[T any] struct {
+	obs    Observer
+	root   *node[T]
+	height int
+	before map[*node[T]]nodeCopy[T]
+}
+
+// nodeCopy is the content of a node before an edit.
+type nodeCopy[T any] struct {
+	keys     []T
+	children []*node[T]
+}
+
+func observeAdd[T any](
+	obs Observer,
+	root *node[T],
+	key T,
+	cmp compareFunc[T],
+) *observation[T] {
+	return newObservation(obs, root, func(n *node[T]) int8 {
+		return n.searchFirst(key, cmp)
+	})
+}
+
+func observeRemove[T any](
+	obs Observer,
+	root *node[T],
+	r *removal[T],
+	cmp compareFunc[T],
+) *observation[T] {
+	return newObservation(obs, root, func(n *node[T]) int8 {
+		return r.childIndex(n, cmp)
+	})
+}
+
+func newObservation[T any](
+	obs Observer,
+	root *node[T],
+	pick func(n *node[T]) int8,
+) *observation[T] {
+	o := &observation[T]{
+		obs:    obs,
+		root:   root,
+		height: height(root),
+		before: make(map[*node[T]]nodeCopy[T]),
+	}
+	for _, n := range touched(root, pick) {
+		c := nodeCopy[T]{keys: append([]T(nil), n.keys[:n.len]...)}
+		if n.isInternalNode() {
+			c.children = append([]*node[T](nil),
+				n.asInternalNode().children[:n.len]...)
+		}
+		o.before[n] = c
+	}
+	return o
+}
+
+// report compares the tree under root, made by the edit, with the one
+// before it level by level from the top, and reports the work done
+// on each level. Only the nodes the edit removed, created or may have
+// changed in place are looked into; the rest are shared by both
+// trees. An edit changes at most two neighbouring nodes of a level, so
+// the way the number of nodes changed tells a split, a merge and a
+// borrow from a plain copy or edit in place.
+func (o *observation[T]) report(root *node[T], eq eqFunc[T]) {
+	top := height(root)
+	var olds, news []*node[T]
+	for h := max(o.height, top); h > 0; h-- {
+		if h == o.height {
+			olds = append(olds, o.root)
+		}
+		if h == top {
+			news = append(news, root)
+		}
+		kept := make(map[*node[T]]bool, len(news))
+		for _, n := range news {
+			kept[n] = true
+		}
+		var removed, inPlace int
+		var nextOlds []*node[T]
+		for _, n := range olds {
+			c, touched := o.before[n]
+			switch {
+			case !kept[n]:
+				removed++
+			case !touched:
+				continue
+			case c.changed(n, eq):
+				inPlace++
+			}
+			if touched {
+				nextOlds = append(nextOlds, c.children...)
+			} else {
+				nextOlds = appendChildren(nextOlds, n)
+			}
+		}
+		existed := make(map[*node[T]]bool, len(olds))
+		for _, n := range olds {
+			existed[n] = true
+		}
+		var created int
+		var nextNews []*node[T]
+		for _, n := range news {
+			_, touched := o.before[n]
+			switch {
+			case !existed[n]:
+				created++
+			case !touched:
+				continue
+			}
+			nextNews = appendChildren(nextNews, n)
+		}
+		olds, news = nextOlds, nextNews
+
+		leaf := h == 1
+		switch {
+		case h > o.height || h > top:
+			// A new root above the halves of the old one, or
+			// an old root replaced by its only child.
+		case created > removed:
+			o.obs.Observe(EventSplit, leaf)
+		case created < removed:
+			o.obs.Observe(EventMerge, leaf)
+		default:
+			if removed+inPlace > 1 {
+				o.obs.Observe(EventBorrow, leaf)
+			}
+			for range created {
+				o.obs.Observe(EventCopy, leaf)
+			}
+		}
+		for range inPlace {
+			o.obs.Observe(EventInPlace, leaf)
+		}
+		for range created {
+			o.obs.Observe(EventAlloc, leaf)
+		}
+	}
+}
+
+// changed reports whether n differs from the copy c taken of it.
+func (c nodeCopy[T]) changed(n *node[T], eq eqFunc[T]) bool {
+	if int(n.len) != len(c.keys) {
+		return true
+	}
+	for i, key := range c.keys {
+		if !eq(key, n.keys[i]) {
+			return true
+		}
+	}
+	for i, child := range c.children {
+		if n.asInternalNode().children[i] != child {
+			return true
+		}
+	}
+	return false
+}
+
+// appendChildren appends the children of n, if it is an internal
+// node, to nodes. A page is loaded to find its children.
+func appendChildren[T any](nodes []*node[T], n *node[T]) []*node[T] {
+	if n.kind == nodeKindPage {
+		n = n.asPageNode().load()
+	}
+	if !n.isInternalNode() {
+		return nodes
+	}
+	return append(nodes, n.asInternalNode().children[:n.len]...)
+}
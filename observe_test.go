@@ -0,0 +1,145 @@
+package btree_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+	"jsouthworth.net/go/btree/treeset"
+)
+
+func TestObserver(t *testing.T) {
+	var c btree.Counters
+	tree := btree.Empty(compare[int], eq[int]).WithObserver(&c)
+	for i := 0; i < 1000; i++ {
+		tree = tree.Add(i)
+	}
+	if got := c.Count(btree.EventInPlace, true); got != 0 {
+		t.Fatalf("persistent adds edited %v leaves in place", got)
+	}
+	copies := c.Count(btree.EventCopy, true)
+	if copies == 0 || c.Count(btree.EventSplit, true) == 0 ||
+		c.Count(btree.EventCopy, false) == 0 {
+		t.Fatalf("got %v", &c)
+	}
+	if got := c.Count(btree.EventAlloc, true); got <
+		copies+2*c.Count(btree.EventSplit, true) {
+		t.Fatalf("got %v leaf allocations for %v copies", got, copies)
+	}
+
+	allocs := c.Count(btree.EventAlloc, true)
+	trans := tree.AsTransient()
+	for i := 1000; i < 2000; i++ {
+		trans.Add(i)
+	}
+	for i := 0; i < 2000; i += 2 {
+		trans.Delete(i)
+	}
+	tree = trans.AsPersistent()
+	if got := c.Count(btree.EventInPlace, true); got < 1000 {
+		t.Fatalf("got %v in place leaf edits for 2000 transient edits", got)
+	}
+	if got := c.Count(btree.EventAlloc, true) - allocs; got > 200 {
+		t.Fatalf("transient allocated %v leaves", got)
+	}
+	for i := 1; i < 2000; i += 2 {
+		tree = tree.Delete(i)
+	}
+	if c.Count(btree.EventMerge, true) == 0 ||
+		c.Count(btree.EventBorrow, true) == 0 {
+		t.Fatalf("got %v", &c)
+	}
+
+	var parsed map[string]map[string]int64
+	if err := json.Unmarshal([]byte(c.String()), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	for e := btree.EventAlloc; e <= btree.EventBorrow; e++ {
+		if parsed[e.String()]["leaf"] != c.Count(e, true) ||
+			parsed[e.String()]["internal"] != c.Count(e, false) {
+			t.Fatalf("got %v for %v", parsed[e.String()], e)
+		}
+	}
+	expvar.Publish("btree_test", &c)
+	if expvar.Get("btree_test").String() != c.String() {
+		t.Fatal("published counters differ")
+	}
+}
+
+func TestObserverEvents(t *testing.T) {
+	base := btree.Empty(compare[int], eq[int]).AsTransient()
+	for i := 0; i < 1000; i += 2 {
+		base.Add(i)
+	}
+	tree := base.AsPersistent()
+	type count struct {
+		e    btree.Event
+		leaf bool
+		n    int64
+	}
+	check := func(name string, c *btree.Counters, want ...count) {
+		var total, all int64
+		for _, w := range want {
+			if got := c.Count(w.e, w.leaf); got != w.n {
+				t.Errorf("%s: got %v %v events on leaves=%v, expected %v",
+					name, got, w.e, w.leaf, w.n)
+			}
+			total += w.n
+		}
+		for e := btree.EventAlloc; e <= btree.EventBorrow; e++ {
+			all += c.Count(e, true) + c.Count(e, false)
+		}
+		if all != total {
+			t.Errorf("%s: got %v", name, c)
+		}
+	}
+
+	var pc btree.Counters
+	tree.WithObserver(&pc).Add(501)
+	check("persistent add", &pc,
+		count{btree.EventCopy, true, 1},
+		count{btree.EventAlloc, true, 1},
+		count{btree.EventCopy, false, 1},
+		count{btree.EventAlloc, false, 1},
+	)
+
+	// The first add copies the path, the later edits change the
+	// copied leaf in place.
+	var tc btree.Counters
+	trans := tree.WithObserver(&tc).AsTransient()
+	trans.Add(501)
+	trans.Add(503)
+	trans.Delete(501)
+	check("transient edits", &tc,
+		count{btree.EventCopy, true, 1},
+		count{btree.EventAlloc, true, 1},
+		count{btree.EventCopy, false, 1},
+		count{btree.EventAlloc, false, 1},
+		count{btree.EventInPlace, true, 2},
+	)
+}
+
+func TestObserverWrappers(t *testing.T) {
+	var ac, mc, sc btree.Counters
+	aug := btree.EmptyAugmented(compare[int], eq[int], sumMonoid{}).
+		WithObserver(&ac)
+	m := treemap.Empty[int, int](compare[int], eq[int]).WithObserver(&mc)
+	s := treeset.Empty(compare[int]).WithObserver(&sc)
+	for i := 0; i < 100; i++ {
+		aug = aug.Add(i)
+		m = m.Assoc(i, i)
+		s = s.Add(i)
+	}
+	for name, c := range map[string]*btree.Counters{
+		"AugBTree": &ac, "Map": &mc, "Set": &sc,
+	} {
+		if c.Count(btree.EventSplit, true) == 0 {
+			t.Errorf("%s: got %v", name, c)
+		}
+	}
+	if aug.Summary() != 4950 {
+		t.Fatalf("got summary %v", aug.Summary())
+	}
+}
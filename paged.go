@@ -0,0 +1,282 @@
+package btree
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// ErrPageCorrupt is returned when a page read from a PageSource does
+// not describe a valid node.
+const ErrPageCorrupt = Error("corrupt page")
+
+// PageID identifies a page of a PageSource.
+type PageID uint64
+
+// Page is the stored form of a node of a paged tree. A leaf page
+// holds elements and an internal page holds references to its
+// children; a page with no children is a leaf.
+type Page[T any] struct {
+	Elems    []T
+	Children []PageRef[T]
+}
+
+// PageRef refers to a child page. Max is the greatest element under
+// the child, which allows searches to choose a child without loading
+// it.
+type PageRef[T any] struct {
+	ID  PageID
+	Max T
+}
+
+// PageSource loads the pages of a paged tree, typically from disk.
+// ReadPage may be called from several goroutines at once.
+type PageSource[T any] interface {
+	ReadPage(id PageID) (Page[T], error)
+}
+
+// PageError is the value a tree opened with PageCache.Open panics
+// with when a node it needs cannot be read from its PageSource.
+type PageError struct {
+	ID  PageID
+	Err error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("btree: reading page %d: %v", e.ID, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// BuildPages stores every node of t with store, children before their
+// parents, and returns the ID of the root page. Together with t's
+// length this is what PageCache.Open needs to read the tree back.
+func BuildPages[T any](
+	t *BTree[T],
+	store func(p Page[T]) (PageID, error),
+) (PageID, error) {
+	var build func(n *node[T]) (PageID, error)
+	build = func(n *node[T]) (PageID, error) {
+		if n.kind == nodeKindLeaf {
+			return store(Page[T]{Elems: n.keys[:n.len:n.len]})
+		}
+		in := n.asInternalNode()
+		refs := make([]PageRef[T], n.len)
+		for i := range n.len {
+			id, err := build(in.child(i))
+			if err != nil {
+				return 0, err
+			}
+			refs[i] = PageRef[T]{ID: id, Max: in.keys[i]}
+		}
+		return store(Page[T]{Children: refs})
+	}
+	return build(t.root)
+}
+
+// pageNode is a child of an internal node that has not been read:
+// a reference to a page that is loaded through the cache whenever
+// the child is needed. The parent's key for it is the page's Max.
+type pageNode[T any] struct {
+	node[T]
+	id    PageID
+	cache *PageCache[T]
+}
+
+func (h *node[T]) asPageNode() *pageNode[T] {
+	return (*pageNode[T])(unsafe.Pointer(h))
+}
+
+// load returns the node stored in the page, panicking with a
+// *PageError if it cannot be read.
+func (p *pageNode[T]) load() *node[T] {
+	n, err := p.cache.get(p.id)
+	if err != nil {
+		panic(&PageError{ID: p.id, Err: err})
+	}
+	return n
+}
+
+// PageCache loads the nodes of trees stored in a PageSource on
+// demand. At most a fixed number of nodes are kept by the cache; the
+// rest are evicted in CLOCK order and read again when needed.
+//
+// Nodes are not pinned: iterators cannot be closed, so the cache
+// cannot know when one is done with a node, and it may evict the nodes
+// an iterator is reading. The iterator is unaffected because it refers
+// to the nodes on its path itself, which keeps them alive until it
+// moves past them. Such nodes no longer count against the capacity,
+// and the cache reads their pages again for any other lookup. The
+// same holds for the root of an open tree and for nodes shared with
+// trees derived from a paged tree by editing it.
+//
+// A PageCache may be used from several goroutines at once.
+type PageCache[T any] struct {
+	mu       sync.Mutex
+	src      PageSource[T]
+	capacity int
+	slots    []pageSlot[T]
+	index    map[PageID]int
+	loading  map[PageID]*pageLoad[T]
+	hand     int
+	stats    PageStats
+}
+
+type pageSlot[T any] struct {
+	id   PageID
+	n    *node[T]
+	used bool
+}
+
+// pageLoad is a read of a page in progress. done is closed once n or
+// err is set.
+type pageLoad[T any] struct {
+	done chan struct{}
+	n    *node[T]
+	err  error
+}
+
+// NewPageCache returns a cache reading pages from src that keeps at
+// most capacity nodes.
+func NewPageCache[T any](src PageSource[T], capacity int) *PageCache[T] {
+	return &PageCache[T]{
+		src:      src,
+		capacity: max(capacity, 1),
+		index:    make(map[PageID]int),
+		loading:  make(map[PageID]*pageLoad[T]),
+	}
+}
+
+// Open returns the tree of count elements rooted at the page root,
+// ordered by cmp and eq. Only the root is read; the other nodes are
+// loaded as operations on the tree reach them, and the tree may be
+// used like any other, including being edited. Operations that fail
+// to load a node panic with a *PageError.
+func (c *PageCache[T]) Open(
+	root PageID,
+	count int,
+	cmp func(a, b T) int,
+	eq func(a, b T) bool,
+) (*BTree[T], error) {
+	n, err := c.get(root)
+	if err != nil {
+		return nil, err
+	}
+	return &BTree[T]{
+		root:  n,
+		count: count,
+		edit:  emptyEdit,
+		cmp:   cmp,
+		eq:    eq,
+	}, nil
+}
+
+// Stats returns counters describing the use of the cache.
+func (c *PageCache[T]) Stats() PageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Resident = len(c.index)
+	return stats
+}
+
+// PageStats counts the work done by a PageCache.
+type PageStats struct {
+	// Resident is the number of nodes currently in the cache.
+	Resident int
+	// Hits and Misses count the node lookups that found the node
+	// resident and that had to load it.
+	Hits, Misses int
+	// Evictions counts the nodes removed to make room for others.
+	Evictions int
+}
+
+// get returns the node stored in the page id, reading it if it is not
+// resident. The lock is not held while reading, so other pages may be
+// used meanwhile; callers asking for a page that is being read wait
+// for that read rather than starting another.
+func (c *PageCache[T]) get(id PageID) (*node[T], error) {
+	c.mu.Lock()
+	if slot, ok := c.index[id]; ok {
+		c.stats.Hits++
+		s := &c.slots[slot]
+		s.used = true
+		c.mu.Unlock()
+		return s.n, nil
+	}
+	if load, ok := c.loading[id]; ok {
+		c.stats.Hits++
+		c.mu.Unlock()
+		<-load.done
+		return load.n, load.err
+	}
+	c.stats.Misses++
+	load := &pageLoad[T]{done: make(chan struct{})}
+	c.loading[id] = load
+	c.mu.Unlock()
+
+	load.n, load.err = c.read(id)
+
+	c.mu.Lock()
+	delete(c.loading, id)
+	// Only the reader adds the page, so it cannot have become
+	// resident meanwhile.
+	if load.err == nil {
+		slot := c.victim()
+		c.slots[slot] = pageSlot[T]{id: id, n: load.n, used: true}
+		c.index[id] = slot
+	}
+	c.mu.Unlock()
+	close(load.done)
+	return load.n, load.err
+}
+
+// read reads the page id and turns it into a node whose children, if
+// it has any, are pages that have not been read.
+func (c *PageCache[T]) read(id PageID) (*node[T], error) {
+	p, err := c.src.ReadPage(id)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(p.Elems) > maxLen || len(p.Children) > maxLen:
+		return nil, ErrPageCorrupt
+	case len(p.Children) == 0:
+		leaf := newLeaf[T](int8(len(p.Elems)), emptyEdit)
+		copy(leaf.keys, p.Elems)
+		return leaf.asNode(), nil
+	}
+	in := newNode[T](int8(len(p.Children)), emptyEdit)
+	for i, ref := range p.Children {
+		in.keys[i] = ref.Max
+		in.children[i] = (&pageNode[T]{
+			node:  node[T]{kind: nodeKindPage, edit: emptyEdit},
+			id:    ref.ID,
+			cache: c,
+		}).asNode()
+	}
+	return in.asNode(), nil
+}
+
+// victim returns a free slot, evicting a node if the cache is full.
+// The hand sweeps over the slots, sparing once every node used since
+// its last pass, so two sweeps always find one.
+func (c *PageCache[T]) victim() int {
+	if len(c.slots) < c.capacity {
+		c.slots = append(c.slots, pageSlot[T]{})
+		return len(c.slots) - 1
+	}
+	for {
+		slot := c.hand
+		c.hand = (c.hand + 1) % len(c.slots)
+		s := &c.slots[slot]
+		if s.used {
+			s.used = false
+			continue
+		}
+		delete(c.index, s.id)
+		c.stats.Evictions++
+		return slot
+	}
+}
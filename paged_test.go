@@ -0,0 +1,218 @@
+package btree_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+)
+
+// memPages is a PageSource held in memory that counts its reads and
+// fails reads of the page in broken. Reads of the page in slow report
+// on started and then wait until gate is closed.
+type memPages struct {
+	pages   []btree.Page[int]
+	reads   atomic.Int64
+	broken  btree.PageID
+	slow    btree.PageID
+	started chan struct{}
+	gate    chan struct{}
+}
+
+var errBrokenPage = errors.New("broken page")
+
+func (m *memPages) ReadPage(id btree.PageID) (btree.Page[int], error) {
+	m.reads.Add(1)
+	if id == m.slow {
+		m.started <- struct{}{}
+		<-m.gate
+	}
+	if id == m.broken {
+		return btree.Page[int]{}, errBrokenPage
+	}
+	return m.pages[id-1], nil
+}
+
+func (m *memPages) store(p btree.Page[int]) (btree.PageID, error) {
+	m.pages = append(m.pages, p)
+	return btree.PageID(len(m.pages)), nil
+}
+
+func openPaged(t *testing.T, elems []int, capacity int) (
+	*btree.BTree[int], *btree.PageCache[int], *memPages,
+) {
+	tree := buildTree(elems)
+	src := &memPages{}
+	root, err := btree.BuildPages(tree, src.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := btree.NewPageCache[int](src, capacity)
+	paged, err := cache.Open(root, tree.Length(), compare[int], eq[int])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paged, cache, src
+}
+
+func TestPaged(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("paged tree behaves like the tree it was built from",
+		prop.ForAll(
+			func(elems []int, probe int, capacity int, edits []int) bool {
+				tree := buildTree(elems)
+				paged, cache, _ := openPaged(t, elems, capacity)
+				if paged.Contains(probe) != tree.Contains(probe) {
+					return false
+				}
+				lo, ok := paged.Min()
+				if tmin, tok := tree.Min(); ok != tok || lo != tmin {
+					return false
+				}
+				hi, ok := paged.Max()
+				if tmax, tok := tree.Max(); ok != tok || hi != tmax {
+					return false
+				}
+				fl, ok := paged.Floor(probe)
+				if tfl, tok := tree.Floor(probe); ok != tok || fl != tfl {
+					return false
+				}
+				if !slices.Equal(slices.Collect(paged.From(probe)),
+					slices.Collect(tree.From(probe))) {
+					return false
+				}
+				// Edits copy the loaded path and keep the
+				// pages that have not been read as they are.
+				edited := paged
+				trans := paged.AsTransient()
+				for _, v := range edits {
+					if v%2 == 0 {
+						tree, edited = tree.Add(v), edited.Add(v)
+						trans.Add(v)
+					} else {
+						tree, edited = tree.Delete(v-1), edited.Delete(v-1)
+						trans.Delete(v - 1)
+					}
+				}
+				return btree.Equal(edited, tree) &&
+					btree.Equal(trans.AsPersistent(), tree) &&
+					cache.Stats().Resident <= max(capacity, 1)
+			},
+			gen.SliceOf(gen.IntRange(0, 20000)),
+			gen.IntRange(-100, 20100),
+			gen.IntRange(0, 20),
+			gen.SliceOf(gen.IntRange(0, 20000)),
+		))
+	properties.TestingRun(t)
+}
+
+func TestPagedCache(t *testing.T) {
+	var elems []int
+	for i := 0; i < 100000; i++ {
+		elems = append(elems, i)
+	}
+	paged, cache, src := openPaged(t, elems, 8)
+	for i := 0; i < 1000; i++ {
+		if !paged.Contains(i * 97) {
+			t.Fatalf("expected to find %v", i*97)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Resident > 8 || stats.Evictions == 0 {
+		t.Fatalf("cache not bounded: %+v", stats)
+	}
+
+	// Iterators hold the nodes on their path, so they carry on
+	// through their leaves without loading them again even once
+	// lookups elsewhere have evicted them from the cache.
+	var iters []btree.Iterator[int]
+	for i := 0; i < 10; i++ {
+		it := paged.IteratorFrom(i * 10000)
+		if !it.HasNext() || it.Next() != i*10000 {
+			t.Fatalf("iterator %v did not start at %v", i, i*10000)
+		}
+		iters = append(iters, it)
+	}
+	for i := 0; i < 1000; i++ {
+		paged.Contains(i*97 + 5)
+	}
+	reads := src.reads.Load()
+	for i := range iters {
+		if !iters[i].HasNext() || iters[i].Next() != i*10000+1 {
+			t.Fatalf("iterator %v lost its place", i)
+		}
+	}
+	if src.reads.Load() != reads {
+		t.Fatal("nodes held by iterators were loaded again")
+	}
+	if got := cache.Stats().Resident; got > 8 {
+		t.Fatalf("got %v resident nodes, expected at most 8", got)
+	}
+}
+
+func TestPagedError(t *testing.T) {
+	var elems []int
+	for i := 0; i < 1000; i++ {
+		elems = append(elems, i)
+	}
+	paged, _, src := openPaged(t, elems, 4)
+	defer func() {
+		var perr *btree.PageError
+		err, _ := recover().(error)
+		if !errors.As(err, &perr) || perr.ID != 1 ||
+			!errors.Is(err, errBrokenPage) {
+			t.Fatalf("got %v expected a page error", err)
+		}
+	}()
+	src.broken = btree.PageID(len(src.pages))
+	fresh := btree.NewPageCache[int](src, 4)
+	if _, err := fresh.Open(src.broken, 1000, compare[int], eq[int]); !errors.Is(err, errBrokenPage) {
+		t.Fatalf("got %v expected %v", err, errBrokenPage)
+	}
+	src.broken = 1 // the first leaf
+	paged.Contains(0)
+}
+
+func TestPagedConcurrentReads(t *testing.T) {
+	var elems []int
+	for i := 0; i < 10000; i++ {
+		elems = append(elems, i)
+	}
+	paged, _, src := openPaged(t, elems, 1000)
+	// Load every page but the first and last leaves.
+	for v := range paged.From(1000) {
+		if v >= 9000 {
+			break
+		}
+	}
+	src.started = make(chan struct{}, 1)
+	src.gate = make(chan struct{})
+	src.slow = 1 // the first leaf
+	reads := src.reads.Load()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			paged.Contains(0)
+		}()
+	}
+	// While the first leaf is being read other pages can still be
+	// loaded, and the lookups waiting for it do not read it again.
+	<-src.started
+	if !paged.Contains(9990) {
+		t.Fatal("expected to find 9990")
+	}
+	close(src.gate)
+	wg.Wait()
+	if got := src.reads.Load() - reads; got != 2 {
+		t.Fatalf("got %v reads, expected the first and last leaves once", got)
+	}
+}
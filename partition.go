@@ -0,0 +1,94 @@
+package btree
+
+import (
+	"iter"
+	"sync"
+)
+
+// Range is a contiguous sub-range of a BTree made up of whole
+// subtrees. Ranges share their nodes with the tree they were taken
+// from and may be iterated independently of each other, including
+// concurrently.
+type Range[T any] struct {
+	cmp  compareFunc[T]
+	root *node[T]
+}
+
+// Iterator returns a stack allocated iterator over the elements of
+// the range.
+func (r Range[T]) Iterator() Iterator[T] {
+	i := makeIterator(r.cmp, r.root)
+	i.HasNext() // Make sure the initial iterator value is valid
+	return i
+}
+
+// All allows one to range over the elements of the Range. This will
+// allocate memory on the heap for the iterator structure.
+func (r Range[T]) All() iter.Seq[T] {
+	i := r.Iterator()
+	return i.Seq
+}
+
+// Partitions splits the tree into at most n contiguous ranges of
+// roughly equal size. The split is made along node boundaries so no
+// elements are copied; the ranges are returned in order and together
+// cover every element of the tree exactly once.
+func (t *BTree[T]) Partitions(n int) []Range[T] {
+	n = max(n, 1)
+	level := []*node[T]{t.root}
+	for len(level) < n && level[0].isInternalNode() {
+		var next []*node[T]
+		for _, nd := range level {
+			in := nd.asInternalNode()
+			for i := range in.len {
+				next = append(next, in.child(i))
+			}
+		}
+		level = next
+	}
+	n = min(n, len(level))
+	out := make([]Range[T], 0, n)
+	for i := 0; i < n; i++ {
+		lo, hi := i*len(level)/n, (i+1)*len(level)/n
+		out = append(out, Range[T]{
+			cmp:  t.cmp,
+			root: joinSubtrees(level[lo:hi]),
+		})
+	}
+	return out
+}
+
+// ParallelForEach calls fn for every element of the tree, splitting
+// the tree into at most n partitions that are each visited on their
+// own goroutine. Elements within a partition are visited in order
+// but there is no ordering between partitions. ParallelForEach
+// returns once every element has been visited.
+func (t *BTree[T]) ParallelForEach(n int, fn func(T)) {
+	var wg sync.WaitGroup
+	for _, r := range t.Partitions(n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i := r.Iterator()
+			for i.HasNext() {
+				fn(i.Next())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// joinSubtrees returns a node covering all of nodes. The nodes must
+// be siblings of the same height, so a single node is returned
+// as-is and several are placed under a new read-only internal node.
+func joinSubtrees[T any](nodes []*node[T]) *node[T] {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	nr := newNode[T](int8(len(nodes)), emptyEdit)
+	for i, child := range nodes {
+		nr.keys[i] = child.maxKey()
+		nr.children[i] = child
+	}
+	return nr.asNode()
+}
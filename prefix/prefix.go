@@ -0,0 +1,182 @@
+// Package prefix provides prefix scans over trees keyed by strings
+// or byte slices. A scan for p visits the keys ordered from p up to
+// the upper bound of p by the collection's own comparator. With a
+// bytewise order, such as strings.Compare or bytes.Compare, these are
+// exactly the keys starting with p; with an order that agrees with it
+// up to some folding, such as a case insensitive order, they are the
+// keys starting with p up to that folding. Scanning a collection
+// whose order puts p after its upper bound, such as a reversed order,
+// panics with ErrOrder.
+package prefix
+
+import (
+	"iter"
+	"slices"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+	"jsouthworth.net/go/btree/treeset"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ErrOrder is the panic raised by a scan of a collection whose order
+// does not keep the keys starting with a prefix together.
+const ErrOrder = Error("prefix: collection is not ordered bytewise")
+
+// UpperBound returns the smallest key that is greater than every key
+// starting with p. ok is false when there is no such key, which is
+// the case when p is empty or made up only of 0xff bytes.
+func UpperBound[S ~string | ~[]byte](p S) (bound S, ok bool) {
+	b := append([]byte(nil), p...)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0xff {
+			b[i]++
+			return S(b[:i+1]), true
+		}
+	}
+	return bound, false
+}
+
+// Prefix allows one to range over the keys of t starting with p, in
+// order.
+func Prefix[S ~string | ~[]byte](t *btree.BTree[S], p S) iter.Seq[S] {
+	below := belowFunc(t.Comparator(), p)
+	return func(yield func(S) bool) {
+		i := t.IteratorFrom(p)
+		for i.HasNext() {
+			key := i.Next()
+			if !below(key) || !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// CountPrefix returns the number of keys of t starting with p.
+func CountPrefix[S ~string | ~[]byte](t *btree.BTree[S], p S) int {
+	return count(Prefix(t, p))
+}
+
+// DeletePrefix returns a tree without the keys starting with p. t is
+// returned unchanged if it has no such keys.
+func DeletePrefix[S ~string | ~[]byte](t *btree.BTree[S], p S) *btree.BTree[S] {
+	keys := slices.Collect(Prefix(t, p))
+	if len(keys) == 0 {
+		return t
+	}
+	tt := t.AsTransient()
+	for _, key := range keys {
+		tt.Delete(key)
+	}
+	return tt.AsPersistent()
+}
+
+// MapPrefix allows one to range over the entries of m whose key
+// starts with p, in order.
+func MapPrefix[K ~string, V any](m *treemap.Map[K, V], p K) iter.Seq2[K, V] {
+	below := belowFunc(m.Comparator(), p)
+	return func(yield func(K, V) bool) {
+		i := m.IteratorFrom(p)
+		for i.HasNext() {
+			key, value := i.Next()
+			if !below(key) || !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// CountMapPrefix returns the number of entries of m whose key starts
+// with p.
+func CountMapPrefix[K ~string, V any](m *treemap.Map[K, V], p K) int {
+	return count(keys(MapPrefix(m, p)))
+}
+
+// DeleteMapPrefix returns a map without the entries whose key starts
+// with p. m is returned unchanged if it has no such entries.
+func DeleteMapPrefix[K ~string, V any](m *treemap.Map[K, V], p K) *treemap.Map[K, V] {
+	prefixed := slices.Collect(keys(MapPrefix(m, p)))
+	if len(prefixed) == 0 {
+		return m
+	}
+	tm := m.AsTransient()
+	for _, key := range prefixed {
+		tm.Delete(key)
+	}
+	return tm.AsPersistent()
+}
+
+// SetPrefix allows one to range over the elements of s starting with
+// p, in order.
+func SetPrefix[S ~string](s *treeset.Set[S], p S) iter.Seq[S] {
+	below := belowFunc(s.Comparator(), p)
+	return func(yield func(S) bool) {
+		i := s.IteratorFrom(p)
+		for i.HasNext() {
+			elem := i.Next()
+			if !below(elem) || !yield(elem) {
+				return
+			}
+		}
+	}
+}
+
+// CountSetPrefix returns the number of elements of s starting with p.
+func CountSetPrefix[S ~string](s *treeset.Set[S], p S) int {
+	return count(SetPrefix(s, p))
+}
+
+// DeleteSetPrefix returns a set without the elements starting with
+// p. s is returned unchanged if it has no such elements.
+func DeleteSetPrefix[S ~string](s *treeset.Set[S], p S) *treeset.Set[S] {
+	elems := slices.Collect(SetPrefix(s, p))
+	if len(elems) == 0 {
+		return s
+	}
+	ts := s.AsTransient()
+	for _, elem := range elems {
+		ts.Remove(elem)
+	}
+	return ts.AsPersistent()
+}
+
+// belowFunc returns a function reporting whether a key, known to be
+// at least p, still starts with p. This is the case when it sorts
+// before the upper bound of p. It panics with ErrOrder if cmp does not
+// order p before its upper bound.
+func belowFunc[S ~string | ~[]byte](cmp func(a, b S) int, p S) func(S) bool {
+	bound, ok := UpperBound(p)
+	if !ok {
+		return func(S) bool { return true }
+	}
+	if cmp(p, bound) >= 0 {
+		panic(ErrOrder)
+	}
+	return func(key S) bool {
+		return cmp(key, bound) < 0
+	}
+}
+
+func count[T any](seq iter.Seq[T]) int {
+	var n int
+	for range seq {
+		n++
+	}
+	return n
+}
+
+// keys drops the values of seq.
+func keys[K, V any](seq iter.Seq2[K, V]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range seq {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package prefix_test
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/prefix"
+	"jsouthworth.net/go/btree/treemap"
+	"jsouthworth.net/go/btree/treeset"
+)
+
+var keys = []string{
+	"", "a", "tenant/", "tenant/a", "tenant/a/1", "tenant/b",
+	"tenant0", "tenant\xff", "tenant\xff\xff", "tenanu",
+	"\xff", "\xff\xff", "\xff\xff/x",
+}
+
+var prefixes = []string{
+	"", "tenant", "tenant/", "tenant/a", "tenant\xff", "\xff",
+	"\xff\xff", "missing",
+}
+
+func expected(p string) []string {
+	var out []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, p) {
+			out = append(out, key)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestUpperBound(t *testing.T) {
+	for _, tc := range []struct {
+		p, bound string
+		ok       bool
+	}{
+		{"", "", false},
+		{"abc", "abd", true},
+		{"ab\xff", "ac", true},
+		{"\xff\xff", "", false},
+	} {
+		bound, ok := prefix.UpperBound(tc.p)
+		if bound != tc.bound || ok != tc.ok {
+			t.Errorf("UpperBound(%q): got %q %v expected %q %v",
+				tc.p, bound, ok, tc.bound, tc.ok)
+		}
+	}
+	p := []byte("a\xff")
+	bound, _ := prefix.UpperBound(p)
+	if string(p) != "a\xff" || string(bound) != "b" {
+		t.Fatalf("got prefix %q bound %q", p, bound)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tree := btree.Empty(strings.Compare,
+		func(a, b string) bool { return a == b })
+	bt := btree.Empty(bytes.Compare, bytes.Equal)
+	m := treemap.Empty[string, int](strings.Compare,
+		func(a, b int) bool { return a == b })
+	s := treeset.Empty(strings.Compare)
+	for i, key := range keys {
+		tree = tree.Add(key)
+		bt = bt.Add([]byte(key))
+		m = m.Assoc(key, i)
+		s = s.Add(key)
+	}
+	for _, p := range prefixes {
+		exp := expected(p)
+		var got []string
+		for key := range prefix.Prefix(tree, p) {
+			got = append(got, key)
+		}
+		if !slices.Equal(got, exp) {
+			t.Errorf("Prefix(%q): got %q expected %q", p, got, exp)
+		}
+		got = got[:0]
+		for key := range prefix.Prefix(bt, []byte(p)) {
+			got = append(got, string(key))
+		}
+		if !slices.Equal(got, exp) {
+			t.Errorf("Prefix([]byte(%q)): got %q expected %q", p, got, exp)
+		}
+		got = got[:0]
+		for key, value := range prefix.MapPrefix(m, p) {
+			if keys[value] != key {
+				t.Errorf("MapPrefix(%q): %q has value %v", p, key, value)
+			}
+			got = append(got, key)
+		}
+		if !slices.Equal(got, exp) {
+			t.Errorf("MapPrefix(%q): got %q expected %q", p, got, exp)
+		}
+		got = slices.Collect(prefix.SetPrefix(s, p))
+		if !slices.Equal(got, exp) {
+			t.Errorf("SetPrefix(%q): got %q expected %q", p, got, exp)
+		}
+
+		if n := prefix.CountPrefix(tree, p); n != len(exp) {
+			t.Errorf("CountPrefix(%q): got %v expected %v", p, n, len(exp))
+		}
+		if n := prefix.CountPrefix(bt, []byte(p)); n != len(exp) {
+			t.Errorf("CountPrefix([]byte(%q)): got %v expected %v",
+				p, n, len(exp))
+		}
+		if n := prefix.CountMapPrefix(m, p); n != len(exp) {
+			t.Errorf("CountMapPrefix(%q): got %v expected %v",
+				p, n, len(exp))
+		}
+		if n := prefix.CountSetPrefix(s, p); n != len(exp) {
+			t.Errorf("CountSetPrefix(%q): got %v expected %v",
+				p, n, len(exp))
+		}
+
+		remaining := len(keys) - len(exp)
+		if n := prefix.DeletePrefix(tree, p).Length(); n != remaining {
+			t.Errorf("DeletePrefix(%q): got %v keys expected %v",
+				p, n, remaining)
+		}
+		if n := prefix.DeletePrefix(bt, []byte(p)).Length(); n != remaining {
+			t.Errorf("DeletePrefix([]byte(%q)): got %v keys expected %v",
+				p, n, remaining)
+		}
+		if n := prefix.CountMapPrefix(prefix.DeleteMapPrefix(m, p), ""); n != remaining {
+			t.Errorf("DeleteMapPrefix(%q): got %v keys expected %v",
+				p, n, remaining)
+		}
+		if n := prefix.DeleteSetPrefix(s, p).Len(); n != remaining {
+			t.Errorf("DeleteSetPrefix(%q): got %v keys expected %v",
+				p, n, remaining)
+		}
+	}
+	if prefix.DeletePrefix(tree, "missing") != tree {
+		t.Fatal("deleting a missing prefix changed the tree")
+	}
+}
+
+func TestPrefixComparator(t *testing.T) {
+	folded := func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	m := treemap.Empty[string, int](folded,
+		func(a, b int) bool { return a == b })
+	s := treeset.Empty(folded)
+	for i, key := range []string{"Tenant/A", "tenant/b", "TENANT/c", "tenanu", "Ten"} {
+		m = m.Assoc(key, i)
+		s = s.Add(key)
+	}
+	exp := []string{"Tenant/A", "tenant/b", "TENANT/c"}
+	var got []string
+	for key := range prefix.MapPrefix(m, "tenant/") {
+		got = append(got, key)
+	}
+	if !slices.Equal(got, exp) {
+		t.Errorf("MapPrefix: got %q expected %q", got, exp)
+	}
+	if got := slices.Collect(prefix.SetPrefix(s, "tenant/")); !slices.Equal(got, exp) {
+		t.Errorf("SetPrefix: got %q expected %q", got, exp)
+	}
+
+	reversed := treeset.Empty(func(a, b string) int {
+		return strings.Compare(b, a)
+	}).Add("tenant/a")
+	defer func() {
+		if r := recover(); r != prefix.ErrOrder {
+			t.Fatalf("got %v expected %v", r, prefix.ErrOrder)
+		}
+	}()
+	prefix.SetPrefix(reversed, "tenant/")
+}
@@ -0,0 +1,422 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// ErrSnapshotCorrupt is returned when reading a snapshot that is
+	// truncated, fails its checksum or describes an invalid tree.
+	ErrSnapshotCorrupt = Error("corrupt snapshot")
+	// ErrSnapshotChain is returned when reading an incremental
+	// snapshot that does not follow the previously read one.
+	ErrSnapshotChain = Error("snapshot does not follow the previous one")
+)
+
+// Codec converts elements to and from the bytes stored in snapshots.
+type Codec[T any] struct {
+	Marshal   func(elem T) ([]byte, error)
+	Unmarshal func(data []byte) (T, error)
+}
+
+// A snapshot file starts with snapshotMagic, the position of the file
+// in its chain and the ID of the first node it defines. Nodes follow
+// in the order they were written, each taking the next ID, so a node
+// only refers to nodes with smaller IDs. The file ends with the root
+// ID, the element count and the CRC-32 of everything before it.
+const snapshotMagic = "BTSNAP\x00\x01"
+
+const (
+	recordLeaf byte = iota + 1
+	recordInternal
+	recordEnd
+)
+
+// SnapshotWriter writes a series of versions of a tree as a chain of
+// snapshot files. The first file holds every node of its tree; each
+// later one only holds the nodes that were not written before, which
+// thanks to path copying are the nodes on the paths to the elements
+// that changed. Nodes are identified by their position in the chain.
+//
+// The writer remembers every node it has written, so it keeps the
+// versions it was given alive until Compact starts a new chain.
+type SnapshotWriter[T any] struct {
+	codec Codec[T]
+	ids   map[*node[T]]uint64
+	seq   uint64
+}
+
+func NewSnapshotWriter[T any](codec Codec[T]) *SnapshotWriter[T] {
+	return &SnapshotWriter[T]{
+		codec: codec,
+		ids:   make(map[*node[T]]uint64),
+	}
+}
+
+// Write writes the next snapshot of the chain to w, holding t. The
+// first snapshot written is the base of the chain. If Write fails
+// the chain is unchanged and the snapshot may be written again.
+func (s *SnapshotWriter[T]) Write(w io.Writer, t *BTree[T]) error {
+	next := uint64(len(s.ids))
+	sw := snapshotWriter[T]{
+		codec: s.codec,
+		old:   s.ids,
+		ids:   make(map[*node[T]]uint64),
+		next:  next,
+		w:     bufio.NewWriter(w),
+		crc:   crc32.NewIEEE(),
+	}
+	sw.bytes([]byte(snapshotMagic))
+	sw.uvarint(s.seq)
+	sw.uvarint(next)
+	root := sw.node(t.root)
+	sw.byte(recordEnd)
+	sw.uvarint(root)
+	sw.uvarint(uint64(t.count))
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.w.Write(sw.crc.Sum(nil))
+	if err := sw.w.Flush(); err != nil {
+		return err
+	}
+	for n, id := range sw.ids {
+		s.ids[n] = id
+	}
+	s.seq++
+	return nil
+}
+
+// Compact writes t to w as the base of a new chain, which later calls
+// to Write extend. Files of the old chain are no longer needed to
+// read the new one and the nodes only they refer to are forgotten.
+func (s *SnapshotWriter[T]) Compact(w io.Writer, t *BTree[T]) error {
+	fresh := NewSnapshotWriter(s.codec)
+	if err := fresh.Write(w, t); err != nil {
+		return err
+	}
+	*s = *fresh
+	return nil
+}
+
+// snapshotWriter writes a single snapshot. The first error is kept
+// and makes every later call do nothing.
+type snapshotWriter[T any] struct {
+	codec Codec[T]
+	old   map[*node[T]]uint64
+	ids   map[*node[T]]uint64
+	next  uint64
+	w     *bufio.Writer
+	crc   hash.Hash32
+	err   error
+	buf   [binary.MaxVarintLen64]byte
+}
+
+// node writes n and the nodes under it that were not written before,
+// children first, and returns its ID.
+func (sw *snapshotWriter[T]) node(n *node[T]) uint64 {
+	if id, ok := sw.old[n]; ok {
+		return id
+	}
+	if id, ok := sw.ids[n]; ok {
+		return id
+	}
+	switch n.kind {
+	case nodeKindLeaf:
+		elems := make([][]byte, n.len)
+		for i, key := range n.keys[:n.len] {
+			data, err := sw.codec.Marshal(key)
+			if err != nil && sw.err == nil {
+				sw.err = fmt.Errorf("marshaling snapshot: %w", err)
+			}
+			elems[i] = data
+		}
+		sw.byte(recordLeaf)
+		sw.uvarint(uint64(n.len))
+		for _, data := range elems {
+			sw.uvarint(uint64(len(data)))
+			sw.bytes(data)
+		}
+	case nodeKindInternal:
+		in := n.asInternalNode()
+		ids := make([]uint64, n.len)
+		for i := range n.len {
+			ids[i] = sw.node(in.child(i))
+		}
+		sw.byte(recordInternal)
+		sw.uvarint(uint64(n.len))
+		for _, id := range ids {
+			sw.uvarint(id)
+		}
+	}
+	id := sw.next
+	sw.next++
+	sw.ids[n] = id
+	return id
+}
+
+func (sw *snapshotWriter[T]) uvarint(v uint64) {
+	sw.bytes(binary.AppendUvarint(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter[T]) byte(b byte) {
+	sw.bytes([]byte{b})
+}
+
+func (sw *snapshotWriter[T]) bytes(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc.Write(b)
+	_, sw.err = sw.w.Write(b)
+}
+
+// SnapshotReader reads a chain of snapshot files written by a
+// SnapshotWriter, returning the tree held by each file in turn.
+type SnapshotReader[T any] struct {
+	cmp   compareFunc[T]
+	eq    eqFunc[T]
+	codec Codec[T]
+	nodes []*node[T]
+	seq   uint64
+}
+
+func NewSnapshotReader[T any](
+	cmp func(a, b T) int,
+	eq func(a, b T) bool,
+	codec Codec[T],
+) *SnapshotReader[T] {
+	return &SnapshotReader[T]{cmp: cmp, eq: eq, codec: codec}
+}
+
+// Read reads the next snapshot of the chain from r and returns its
+// tree. Reading a base snapshot starts a new chain. Any snapshot of a
+// chain is rebuilt by reading the files up to it in order.
+func (s *SnapshotReader[T]) Read(r io.Reader) (*BTree[T], error) {
+	sr := snapshotReader[T]{
+		cmp:   s.cmp,
+		codec: s.codec,
+		r:     bufio.NewReader(r),
+		crc:   crc32.NewIEEE(),
+	}
+	magic := sr.bytes(len(snapshotMagic))
+	if sr.err == nil && string(magic) != snapshotMagic {
+		return nil, ErrSnapshotCorrupt
+	}
+	seq, first := sr.uvarint(), sr.uvarint()
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	sr.old = s.nodes
+	if seq == 0 {
+		sr.old = nil
+	}
+	if first != uint64(len(sr.old)) || seq != 0 && seq != s.seq {
+		return nil, ErrSnapshotChain
+	}
+	var root *node[T]
+	var count uint64
+	for root == nil && sr.err == nil {
+		switch sr.byte() {
+		case recordLeaf:
+			sr.leaf()
+		case recordInternal:
+			sr.internal()
+		case recordEnd:
+			root, count = sr.lookup(sr.uvarint()), sr.uvarint()
+		default:
+			sr.fail()
+		}
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	sum := sr.crc.Sum32()
+	var trailer [4]byte
+	if _, err := io.ReadFull(sr.r, trailer[:]); err != nil ||
+		binary.BigEndian.Uint32(trailer[:]) != sum {
+		return nil, ErrSnapshotCorrupt
+	}
+	s.nodes = append(sr.old, sr.nodes...)
+	s.seq = seq + 1
+	return &BTree[T]{
+		root:  root,
+		count: int(count),
+		edit:  emptyEdit,
+		cmp:   s.cmp,
+		eq:    s.eq,
+	}, nil
+}
+
+// Writer returns a SnapshotWriter that extends the chain read so far,
+// so that a process may carry on a chain written by an earlier one.
+func (s *SnapshotReader[T]) Writer() *SnapshotWriter[T] {
+	w := NewSnapshotWriter(s.codec)
+	for id, n := range s.nodes {
+		w.ids[n] = uint64(id)
+	}
+	w.seq = s.seq
+	return w
+}
+
+// snapshotReader reads a single snapshot. Like snapshotWriter it
+// keeps the first error. Each node is checked as it is read, so the
+// nodes it refers to are known to be valid.
+type snapshotReader[T any] struct {
+	cmp   compareFunc[T]
+	codec Codec[T]
+	old   []*node[T]
+	nodes []*node[T]
+	r     *bufio.Reader
+	crc   hash.Hash32
+	err   error
+}
+
+func (sr *snapshotReader[T]) leaf() {
+	n := sr.len()
+	leaf := newLeaf[T](n, emptyEdit)
+	for i := range leaf.keys {
+		data := sr.bytes(sr.int())
+		if sr.err != nil {
+			return
+		}
+		key, err := sr.codec.Unmarshal(data)
+		if err != nil {
+			sr.err = fmt.Errorf("unmarshaling snapshot: %w", err)
+			return
+		}
+		if i > 0 && sr.cmp(leaf.keys[i-1], key) >= 0 {
+			sr.fail()
+			return
+		}
+		leaf.keys[i] = key
+	}
+	sr.nodes = append(sr.nodes, leaf.asNode())
+}
+
+func (sr *snapshotReader[T]) internal() {
+	n := sr.len()
+	in := newNode[T](n, emptyEdit)
+	for i := range in.children {
+		child := sr.lookup(sr.uvarint())
+		if sr.err != nil {
+			return
+		}
+		if child.len == 0 || i > 0 && !sr.follows(in.children[i-1], child) {
+			sr.fail()
+			return
+		}
+		in.children[i] = child
+		in.keys[i] = child.maxKey()
+	}
+	if n == 0 || height(in.asNode()) > maxIterDepth {
+		sr.fail()
+		return
+	}
+	sr.nodes = append(sr.nodes, in.asNode())
+}
+
+// follows reports whether next may be the sibling after prev: both
+// are as high and every element of next is greater than those of
+// prev.
+func (sr *snapshotReader[T]) follows(prev, next *node[T]) bool {
+	if height(prev) != height(next) {
+		return false
+	}
+	lo, _ := next.first()
+	return sr.cmp(prev.maxKey(), lo) < 0
+}
+
+// height returns the number of levels of the valid subtree under n,
+// counting the leaves.
+func height[T any](n *node[T]) int {
+	h := 1
+	for ; n.isInternalNode(); h++ {
+		n = n.asInternalNode().child(0)
+	}
+	return h
+}
+
+// lookup returns the node with the given ID, which must have been
+// read already.
+func (sr *snapshotReader[T]) lookup(id uint64) *node[T] {
+	switch {
+	case sr.err != nil:
+		return nil
+	case id < uint64(len(sr.old)):
+		return sr.old[id]
+	case id-uint64(len(sr.old)) < uint64(len(sr.nodes)):
+		return sr.nodes[id-uint64(len(sr.old))]
+	}
+	sr.fail()
+	return nil
+}
+
+func (sr *snapshotReader[T]) len() int8 {
+	n := sr.uvarint()
+	if n > maxLen {
+		sr.fail()
+		return 0
+	}
+	return int8(n)
+}
+
+func (sr *snapshotReader[T]) int() int {
+	n := sr.uvarint()
+	if n > 1<<31 {
+		sr.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *snapshotReader[T]) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr)
+	if err != nil {
+		sr.fail()
+	}
+	return v
+}
+
+func (sr *snapshotReader[T]) byte() byte {
+	if b := sr.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (sr *snapshotReader[T]) bytes(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		sr.fail()
+		return nil
+	}
+	sr.crc.Write(b)
+	return b
+}
+
+// ReadByte allows binary.ReadUvarint to read from sr.
+func (sr *snapshotReader[T]) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (sr *snapshotReader[T]) fail() {
+	if sr.err == nil {
+		sr.err = ErrSnapshotCorrupt
+	}
+}
@@ -0,0 +1,194 @@
+package btree_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree"
+)
+
+var intCodec = btree.Codec[int]{
+	Marshal: func(elem int) ([]byte, error) {
+		return binary.AppendVarint(nil, int64(elem)), nil
+	},
+	Unmarshal: func(data []byte) (int, error) {
+		v, n := binary.Varint(data)
+		if n != len(data) {
+			return 0, errors.New("bad varint")
+		}
+		return int(v), nil
+	},
+}
+
+func TestSnapshotChain(t *testing.T) {
+	tree := buildTree(slices.Collect(func(yield func(int) bool) {
+		for i := 0; i < 100000; i++ {
+			yield(i * 2)
+		}
+	}))
+	w := btree.NewSnapshotWriter(intCodec)
+	var files []*bytes.Buffer
+	var versions []*btree.BTree[int]
+	for v := 0; v < 5; v++ {
+		var b bytes.Buffer
+		if err := w.Write(&b, tree); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, &b)
+		versions = append(versions, tree)
+		tree = tree.Add(v*1000 + 1).Delete(v * 4000)
+	}
+	for i, f := range files[1:] {
+		if f.Len() > files[0].Len()/50 {
+			t.Fatalf("snapshot %v is %v bytes, base is %v",
+				i+1, f.Len(), files[0].Len())
+		}
+	}
+
+	r := btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+	for i, f := range files {
+		got, err := r.Read(bytes.NewReader(f.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !btree.Equal(got, versions[i]) || got.Length() != versions[i].Length() {
+			t.Fatalf("snapshot %v differs from the tree written", i)
+		}
+	}
+
+	// A writer resumed from the reader extends the same chain.
+	var next bytes.Buffer
+	if err := r.Writer().Write(&next, tree); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Read(&next)
+	if err != nil || !btree.Equal(got, tree) {
+		t.Fatalf("resumed snapshot differs: %v", err)
+	}
+	if !got.Add(-1).Contains(-1) || got.Delete(2).Contains(2) {
+		t.Fatal("tree read from a snapshot cannot be updated")
+	}
+
+	// Files must be read in order.
+	r = btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+	if _, err := r.Read(bytes.NewReader(files[1].Bytes())); !errors.Is(err, btree.ErrSnapshotChain) {
+		t.Fatalf("got %v expected %v", err, btree.ErrSnapshotChain)
+	}
+}
+
+func TestSnapshotCompact(t *testing.T) {
+	tree := buildTree([]int{1, 2, 3})
+	w := btree.NewSnapshotWriter(intCodec)
+	var old bytes.Buffer
+	for i := 4; i < 1000; i++ {
+		tree = tree.Add(i)
+		old.Reset()
+		if err := w.Write(&old, tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var base, inc bytes.Buffer
+	if err := w.Compact(&base, tree); err != nil {
+		t.Fatal(err)
+	}
+	tree = tree.Delete(500)
+	if err := w.Write(&inc, tree); err != nil {
+		t.Fatal(err)
+	}
+	r := btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+	if _, err := r.Read(&base); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Read(&inc)
+	if err != nil || !btree.Equal(got, tree) {
+		t.Fatalf("compacted chain differs: %v", err)
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	var b bytes.Buffer
+	w := btree.NewSnapshotWriter(intCodec)
+	if err := w.Write(&b, buildTree([]int{1, 2, 3, 4, 5})); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	for i := range data {
+		corrupt := slices.Clone(data)
+		corrupt[i] ^= 0x40
+		r := btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+		if _, err := r.Read(bytes.NewReader(corrupt)); err == nil {
+			t.Fatalf("corrupting byte %v went unnoticed", i)
+		}
+	}
+	r := btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+	if _, err := r.Read(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, btree.ErrSnapshotCorrupt) {
+		t.Fatalf("got %v expected %v", err, btree.ErrSnapshotCorrupt)
+	}
+}
+
+// encodeSnapshot encodes a base snapshot from raw records, as the
+// writer would, so that the reader's checks of the tree can be hit.
+func encodeSnapshot(records [][]uint64, root uint64) []byte {
+	data := []byte("BTSNAP\x00\x01")
+	data = binary.AppendUvarint(data, 0)
+	data = binary.AppendUvarint(data, 0)
+	for _, rec := range records {
+		data = append(data, byte(rec[0]))
+		data = binary.AppendUvarint(data, uint64(len(rec)-1))
+		for _, v := range rec[1:] {
+			if rec[0] == 1 {
+				elem, _ := intCodec.Marshal(int(v))
+				data = binary.AppendUvarint(data, uint64(len(elem)))
+				data = append(data, elem...)
+			} else {
+				data = binary.AppendUvarint(data, v)
+			}
+		}
+	}
+	data = append(data, 3)
+	data = binary.AppendUvarint(data, root)
+	data = binary.AppendUvarint(data, 1)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+func TestSnapshotInvalidTree(t *testing.T) {
+	const leaf, internal = 1, 2
+	chain := func(depth int) [][]uint64 {
+		records := [][]uint64{{leaf, 1}}
+		for i := 1; i < depth; i++ {
+			records = append(records, []uint64{internal, uint64(i - 1)})
+		}
+		return records
+	}
+	for _, tc := range []struct {
+		name    string
+		records [][]uint64
+		ok      bool
+	}{
+		{"valid", [][]uint64{{leaf, 1, 2}, {leaf, 3}, {internal, 0, 1}}, true},
+		{"unordered leaf", [][]uint64{{leaf, 2, 1}}, false},
+		{"duplicate", [][]uint64{{leaf, 1, 1}}, false},
+		{"overlapping siblings",
+			[][]uint64{{leaf, 1, 5}, {leaf, 3, 7}, {internal, 0, 1}}, false},
+		{"uneven heights",
+			[][]uint64{{leaf, 1}, {leaf, 2}, {internal, 1}, {internal, 0, 2}},
+			false},
+		{"deepest", chain(13), true},
+		{"too deep", chain(14), false},
+	} {
+		data := encodeSnapshot(tc.records, uint64(len(tc.records)-1))
+		r := btree.NewSnapshotReader(compare[int], eq[int], intCodec)
+		_, err := r.Read(bytes.NewReader(data))
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, btree.ErrSnapshotCorrupt) {
+			t.Errorf("%s: got %v expected %v",
+				tc.name, err, btree.ErrSnapshotCorrupt)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Package sync brings two replicas of a tree into agreement by
+// exchanging only the parts in which they differ. The replicas
+// compare digests of key ranges over a stream, descend into the
+// ranges whose digests differ and send each other the elements of
+// ranges small enough to ship whole. When the exchange ends both
+// replicas hold the union of their elements.
+//
+// A sync never removes elements, so deletes must be recorded as
+// elements themselves, for instance as the tombstones kept by package
+// crdt. Elements are sent with encoding/gob and must be encodable by
+// it.
+package sync
+
+import (
+	"encoding/gob"
+	"io"
+
+	"jsouthworth.net/go/btree"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ErrProtocol is returned when the peer sends a message that does
+// not follow the protocol.
+const ErrProtocol = Error("malformed sync message")
+
+// Digest summarizes a set of elements by their count and the sum of
+// their hashes. It does not depend on the order elements were added
+// in, so replicas holding the same elements have the same digest
+// whatever the shape of their trees.
+type Digest struct {
+	Count int
+	Sum   uint64
+}
+
+func (d Digest) sub(o Digest) Digest {
+	return Digest{Count: d.Count - o.Count, Sum: d.Sum - o.Sum}
+}
+
+// Hasher is the Monoid summarizing a tree by Digest. Elements that
+// compare equal but are not the same must hash differently, otherwise
+// a changed element may go unnoticed.
+type Hasher[T any] func(elem T) uint64
+
+func (h Hasher[T]) Identity() Digest {
+	return Digest{}
+}
+
+func (h Hasher[T]) Measure(elem T) Digest {
+	return Digest{Count: 1, Sum: mix(h(elem))}
+}
+
+func (h Hasher[T]) Combine(a, b Digest) Digest {
+	return Digest{Count: a.Count + b.Count, Sum: a.Sum + b.Sum}
+}
+
+// mix scrambles a hash with the splitmix64 finalizer so that sums of
+// weak hashes, such as those of small integers, rarely collide.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Empty returns an empty tree that can be synced. Its elements are
+// ordered by cmp and hashed by hash.
+func Empty[T any](
+	cmp func(a, b T) int,
+	eq func(a, b T) bool,
+	hash func(elem T) uint64,
+) *btree.AugBTree[T, Digest] {
+	return btree.EmptyAugmented[T, Digest](cmp, eq, Hasher[T](hash))
+}
+
+// Config tunes a sync. The zero Config is ready to use.
+type Config[T any] struct {
+	// Resolve picks the element to keep when the replicas hold
+	// elements that compare equal but are not the same. The replica
+	// that merges the range calls it and the other one adopts its
+	// choice. If Resolve is nil the merging replica keeps its own
+	// element.
+	Resolve func(local, remote T) T
+	// Fanout is the number of ranges a differing range is split
+	// into. It defaults to 16.
+	Fanout int
+	// Threshold is the number of elements up to which a differing
+	// range is sent whole instead of being split. It defaults to 16.
+	Threshold int
+}
+
+// Sync starts a sync of t with the replica at the other end of rw,
+// which must call Serve. It returns t updated with the elements of
+// the peer. If an error occurs the tree synced so far is returned
+// along with it; it holds every element of t.
+func Sync[T any](
+	rw io.ReadWriter,
+	t *btree.AugBTree[T, Digest],
+	cfg Config[T],
+) (*btree.AugBTree[T, Digest], error) {
+	p := newPeer(rw, t, cfg)
+	err := p.send(message[T]{Spans: []span[T]{{
+		Lo:     bound[T]{Inf: true},
+		Hi:     bound[T]{Inf: true},
+		Kind:   spanDigest,
+		Digest: t.Summary(),
+	}}})
+	if err != nil {
+		return t, err
+	}
+	return p.run()
+}
+
+// Serve answers a sync started by the replica at the other end of rw.
+// See Sync.
+func Serve[T any](
+	rw io.ReadWriter,
+	t *btree.AugBTree[T, Digest],
+	cfg Config[T],
+) (*btree.AugBTree[T, Digest], error) {
+	return newPeer(rw, t, cfg).run()
+}
+
+// Kinds of span.
+const (
+	// spanDigest carries the digest of the sender's elements in the
+	// range. The receiver answers with finer spans or its elements.
+	spanDigest uint8 = iota + 1
+	// spanElems carries the sender's elements in the range. The
+	// receiver merges them and answers with the result if it
+	// differs.
+	spanElems
+	// spanSet carries the merged elements of the range, which the
+	// receiver adopts.
+	spanSet
+)
+
+// bound is one end of a span. Lower bounds are inclusive and upper
+// bounds exclusive; Inf marks an unbounded end.
+type bound[T any] struct {
+	Key T
+	Inf bool
+}
+
+type span[T any] struct {
+	Lo, Hi bound[T]
+	Kind   uint8
+	Digest Digest
+	Elems  []T
+}
+
+type message[T any] struct {
+	Spans []span[T]
+}
+
+// wantsReply reports whether the receiver of m must answer it. The
+// exchange ends with a message that does not.
+func (m *message[T]) wantsReply() bool {
+	for _, s := range m.Spans {
+		if s.Kind != spanSet {
+			return true
+		}
+	}
+	return false
+}
+
+// summarized is implemented by both AugBTree and TAugBTree.
+type summarized[T any] interface {
+	Summary() Digest
+	Aggregate(lo, hi T) Digest
+	Iterator() btree.Iterator[T]
+	IteratorFrom(from T) btree.Iterator[T]
+}
+
+type peer[T any] struct {
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+	cfg  Config[T]
+	cmp  func(a, b T) int
+	tree *btree.AugBTree[T, Digest]
+}
+
+func newPeer[T any](
+	rw io.ReadWriter,
+	t *btree.AugBTree[T, Digest],
+	cfg Config[T],
+) *peer[T] {
+	if cfg.Fanout < 2 {
+		cfg.Fanout = 16
+	}
+	if cfg.Threshold < 1 {
+		cfg.Threshold = 16
+	}
+	return &peer[T]{
+		enc:  gob.NewEncoder(rw),
+		dec:  gob.NewDecoder(rw),
+		cfg:  cfg,
+		cmp:  t.Comparator(),
+		tree: t,
+	}
+}
+
+func (p *peer[T]) send(m message[T]) error {
+	return p.enc.Encode(&m)
+}
+
+// run answers messages until the exchange ends.
+func (p *peer[T]) run() (*btree.AugBTree[T, Digest], error) {
+	for {
+		// gob leaves fields missing from the stream untouched, so
+		// every message must be decoded into a fresh value.
+		var in message[T]
+		if err := p.dec.Decode(&in); err != nil {
+			return p.tree, err
+		}
+		out, err := p.answer(&in)
+		if err != nil {
+			return p.tree, err
+		}
+		if !in.wantsReply() {
+			return p.tree, nil
+		}
+		if err := p.send(out); err != nil {
+			return p.tree, err
+		}
+		if !out.wantsReply() {
+			return p.tree, nil
+		}
+	}
+}
+
+// answer applies the spans of in to the tree and returns the reply.
+// The spans of a message never overlap, so each may read the tree as
+// it was before the message.
+func (p *peer[T]) answer(in *message[T]) (message[T], error) {
+	var out message[T]
+	tx := p.tree.AsTransient()
+	for _, s := range in.Spans {
+		if err := p.check(&s); err != nil {
+			return out, err
+		}
+		switch s.Kind {
+		case spanDigest:
+			local := p.digest(p.tree, s.Lo, s.Hi)
+			switch {
+			case local == s.Digest:
+			case s.Digest.Count == 0:
+				out.Spans = append(out.Spans, span[T]{
+					Lo:    s.Lo,
+					Hi:    s.Hi,
+					Kind:  spanSet,
+					Elems: p.elems(p.tree, s.Lo, s.Hi),
+				})
+			case local.Count <= p.cfg.Threshold:
+				out.Spans = append(out.Spans, span[T]{
+					Lo:     s.Lo,
+					Hi:     s.Hi,
+					Kind:   spanElems,
+					Digest: local,
+					Elems:  p.elems(p.tree, s.Lo, s.Hi),
+				})
+			default:
+				out.Spans = append(out.Spans, p.split(s.Lo, s.Hi)...)
+			}
+		case spanElems:
+			merged := p.merge(tx, &s)
+			if p.digest(tx, s.Lo, s.Hi) != s.Digest {
+				out.Spans = append(out.Spans, span[T]{
+					Lo:    s.Lo,
+					Hi:    s.Hi,
+					Kind:  spanSet,
+					Elems: merged,
+				})
+			}
+		case spanSet:
+			p.replace(tx, &s)
+		}
+	}
+	p.tree = tx.AsPersistent()
+	return out, nil
+}
+
+// check verifies that the elements of s are in order and within its
+// range.
+func (p *peer[T]) check(s *span[T]) error {
+	switch s.Kind {
+	case spanDigest, spanElems, spanSet:
+	default:
+		return ErrProtocol
+	}
+	for i, elem := range s.Elems {
+		if i > 0 && p.cmp(s.Elems[i-1], elem) >= 0 ||
+			!s.Lo.Inf && p.cmp(elem, s.Lo.Key) < 0 ||
+			!s.Hi.Inf && p.cmp(elem, s.Hi.Key) >= 0 {
+			return ErrProtocol
+		}
+	}
+	return nil
+}
+
+// digest returns the digest of the elements of t in [lo, hi).
+func (p *peer[T]) digest(t summarized[T], lo, hi bound[T]) Digest {
+	upper := t.Summary()
+	if !hi.Inf {
+		upper = p.below(t, hi.Key)
+	}
+	if lo.Inf {
+		return upper
+	}
+	return upper.sub(p.below(t, lo.Key))
+}
+
+// below returns the digest of the elements of t less than key.
+func (p *peer[T]) below(t summarized[T], key T) Digest {
+	i := t.Iterator()
+	if !i.HasNext() {
+		return Digest{}
+	}
+	first := i.Next()
+	if p.cmp(first, key) >= 0 {
+		return Digest{}
+	}
+	return t.Aggregate(first, key).sub(t.Aggregate(key, key))
+}
+
+// elems returns the elements of t in [lo, hi).
+func (p *peer[T]) elems(t summarized[T], lo, hi bound[T]) []T {
+	i := t.Iterator()
+	if !lo.Inf {
+		i = t.IteratorFrom(lo.Key)
+	}
+	var out []T
+	for i.HasNext() {
+		elem := i.Next()
+		if !hi.Inf && p.cmp(elem, hi.Key) >= 0 {
+			break
+		}
+		out = append(out, elem)
+	}
+	return out
+}
+
+// split divides [lo, hi) into at most Fanout ranges holding about the
+// same number of local elements and returns their digests.
+func (p *peer[T]) split(lo, hi bound[T]) []span[T] {
+	elems := p.elems(p.tree, lo, hi)
+	out := make([]span[T], 0, p.cfg.Fanout)
+	start := lo
+	for i := 1; i <= p.cfg.Fanout; i++ {
+		end := hi
+		if i < p.cfg.Fanout {
+			end = bound[T]{Key: elems[i*len(elems)/p.cfg.Fanout]}
+			if !start.Inf && p.cmp(start.Key, end.Key) >= 0 {
+				continue
+			}
+		}
+		out = append(out, span[T]{
+			Lo:     start,
+			Hi:     end,
+			Kind:   spanDigest,
+			Digest: p.digest(p.tree, start, end),
+		})
+		start = end
+	}
+	return out
+}
+
+// merge adds the elements of s to tx, resolving those that compare
+// equal to a local element, and returns the merged elements of its
+// range.
+func (p *peer[T]) merge(tx *btree.TAugBTree[T, Digest], s *span[T]) []T {
+	local := p.elems(p.tree, s.Lo, s.Hi)
+	out := make([]T, 0, max(len(local), len(s.Elems)))
+	var i, j int
+	for i < len(local) || j < len(s.Elems) {
+		switch {
+		case j == len(s.Elems) ||
+			i < len(local) && p.cmp(local[i], s.Elems[j]) < 0:
+			out = append(out, local[i])
+			i++
+		case i == len(local) || p.cmp(local[i], s.Elems[j]) > 0:
+			tx.Add(s.Elems[j])
+			out = append(out, s.Elems[j])
+			j++
+		default:
+			elem := local[i]
+			if p.cfg.Resolve != nil {
+				elem = p.cfg.Resolve(local[i], s.Elems[j])
+				tx.Add(elem)
+			}
+			out = append(out, elem)
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// replace makes the elements of s the only ones of its range in tx.
+func (p *peer[T]) replace(tx *btree.TAugBTree[T, Digest], s *span[T]) {
+	local := p.elems(p.tree, s.Lo, s.Hi)
+	var j int
+	for _, elem := range local {
+		for j < len(s.Elems) && p.cmp(s.Elems[j], elem) < 0 {
+			j++
+		}
+		if j == len(s.Elems) || p.cmp(s.Elems[j], elem) != 0 {
+			tx.Delete(elem)
+		}
+	}
+	for _, elem := range s.Elems {
+		tx.Add(elem)
+	}
+}
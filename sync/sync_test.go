@@ -0,0 +1,164 @@
+package sync_test
+
+import (
+	"cmp"
+	"io"
+	"maps"
+	"net"
+	"testing"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/sync"
+)
+
+// entry is a map entry with a version, the later of two versions of
+// an entry wins.
+type entry struct {
+	Key, Version int
+}
+
+func compareEntry(a, b entry) int {
+	return cmp.Compare(a.Key, b.Key)
+}
+
+func eqEntry(a, b entry) bool {
+	return a == b
+}
+
+func hashEntry(e entry) uint64 {
+	return uint64(e.Key)<<32 ^ uint64(e.Version)
+}
+
+func later(local, remote entry) entry {
+	if remote.Version > local.Version {
+		return remote
+	}
+	return local
+}
+
+func fromMap(m map[int]int) *btree.AugBTree[entry, sync.Digest] {
+	t := sync.Empty(compareEntry, eqEntry, hashEntry).AsTransient()
+	for k, v := range m {
+		t.Add(entry{k, v})
+	}
+	return t.AsPersistent()
+}
+
+func toMap(t *btree.AugBTree[entry, sync.Digest]) map[int]int {
+	m := map[int]int{}
+	for e := range t.All() {
+		m[e.Key] = e.Version
+	}
+	return m
+}
+
+// counter counts the bytes written through it.
+type counter struct {
+	io.ReadWriter
+	n int
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	c.n += len(b)
+	return c.ReadWriter.Write(b)
+}
+
+// syncPipe syncs a with b over net.Pipe and returns both results and
+// the number of bytes sent.
+func syncPipe(
+	t *testing.T,
+	a, b *btree.AugBTree[entry, sync.Digest],
+	cfg sync.Config[entry],
+) (*btree.AugBTree[entry, sync.Digest], *btree.AugBTree[entry, sync.Digest], int) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	w1, w2 := &counter{ReadWriter: c1}, &counter{ReadWriter: c2}
+	done := make(chan error)
+	go func() {
+		var err error
+		b, err = sync.Serve(w2, b, cfg)
+		done <- err
+	}()
+	a, err := sync.Sync(w1, a, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return a, b, w1.n + w2.n
+}
+
+func TestSync(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	versions := gen.MapOf(gen.IntRange(0, 2000), gen.IntRange(0, 3))
+	properties.Property("Sync leaves both replicas with the union",
+		prop.ForAll(
+			func(ma, mb map[int]int, threshold int) bool {
+				expected := maps.Clone(ma)
+				for k, v := range mb {
+					expected[k] = max(expected[k], v)
+				}
+				cfg := sync.Config[entry]{
+					Resolve:   later,
+					Fanout:    4,
+					Threshold: threshold,
+				}
+				a, b, _ := syncPipe(t, fromMap(ma), fromMap(mb), cfg)
+				return maps.Equal(toMap(a), expected) &&
+					maps.Equal(toMap(b), expected)
+			},
+			versions, versions, gen.IntRange(1, 8),
+		))
+	properties.TestingRun(t)
+}
+
+func TestSyncSendsDifferences(t *testing.T) {
+	m := map[int]int{}
+	for i := 0; i < 100000; i++ {
+		m[i] = 1
+	}
+	a := fromMap(m)
+	m[500] = 2
+	m[70000] = 2
+	delete(m, 99999)
+	m[200000] = 1
+	b := fromMap(m)
+	cfg := sync.Config[entry]{Resolve: later}
+	a, b, n := syncPipe(t, a, b, cfg)
+	if !maps.Equal(toMap(a), toMap(b)) || a.Length() != 100001 {
+		t.Fatalf("replicas differ after sync")
+	}
+	if a.At(entry{Key: 500}).Version != 2 {
+		t.Fatalf("expected the later version to win")
+	}
+	if n > 16<<10 {
+		t.Fatalf("sent %v bytes to sync a handful of elements", n)
+	}
+	_, _, n = syncPipe(t, a, b, cfg)
+	if n > 1<<10 {
+		t.Fatalf("sent %v bytes to sync equal replicas", n)
+	}
+}
+
+func TestSyncPeerGone(t *testing.T) {
+	c1, c2 := net.Pipe()
+	go func() {
+		var b [1]byte
+		c2.Read(b[:])
+		c2.Close()
+	}()
+	a := fromMap(map[int]int{1: 1, 2: 1})
+	got, err := sync.Sync(c1, a, sync.Config[entry]{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got != a {
+		t.Fatal("expected the tree to be unchanged")
+	}
+}
@@ -0,0 +1,230 @@
+// Package treebag implements a persistent sorted multiset. Each
+// distinct element is stored once together with the number of times
+// it occurs.
+package treebag
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+type Bag[T any] struct {
+	impl  *btree.BTree[entry[T]]
+	total int
+}
+
+func Empty[T any](cmp func(a, b T) int) *Bag[T] {
+	return &Bag[T]{
+		impl: btree.Empty[entry[T]](
+			func(a, b entry[T]) int {
+				return cmp(a.elem, b.elem)
+			},
+			func(a, b entry[T]) bool {
+				return cmp(a.elem, b.elem) == 0 &&
+					a.count == b.count
+			},
+		),
+	}
+}
+
+func (b *Bag[T]) Contains(elem T) bool {
+	return b.impl.Contains(entry[T]{elem: elem})
+}
+
+// Count returns the number of times elem occurs in the bag.
+func (b *Bag[T]) Count(elem T) int {
+	return b.impl.At(entry[T]{elem: elem}).count
+}
+
+// Add returns a bag with n more occurrences of elem. Adding zero or
+// fewer occurrences returns b.
+func (b *Bag[T]) Add(elem T, n int) *Bag[T] {
+	if n <= 0 {
+		return b
+	}
+	return &Bag[T]{
+		impl:  b.impl.AddFunc(entry[T]{elem: elem, count: n}, addCounts[T]),
+		total: b.total + n,
+	}
+}
+
+// Remove returns a bag with up to n fewer occurrences of elem. The
+// element is removed entirely once its count drops to zero.
+func (b *Bag[T]) Remove(elem T, n int) *Bag[T] {
+	if n <= 0 {
+		return b
+	}
+	var removed int
+	impl := b.impl.UpdateFunc(entry[T]{elem: elem}, removeCount[T](n, &removed))
+	if impl == b.impl {
+		return b
+	}
+	return &Bag[T]{
+		impl:  impl,
+		total: b.total - removed,
+	}
+}
+
+// Len returns the total number of elements in the bag counting
+// duplicates.
+func (b *Bag[T]) Len() int {
+	return b.total
+}
+
+// Distinct returns the number of distinct elements in the bag.
+func (b *Bag[T]) Distinct() int {
+	return b.impl.Length()
+}
+
+// All allows one to range over the distinct elements of the bag in
+// order along with their counts.
+func (b *Bag[T]) All() iter.Seq2[T, int] {
+	i := b.Iterator()
+	return i.Seq2
+}
+
+func (b *Bag[T]) From(elem T) iter.Seq2[T, int] {
+	i := b.IteratorFrom(elem)
+	return i.Seq2
+}
+
+func (b *Bag[T]) Iterator() Iterator[T] {
+	return Iterator[T]{
+		impl: b.impl.Iterator(),
+	}
+}
+
+func (b *Bag[T]) IteratorFrom(elem T) Iterator[T] {
+	return Iterator[T]{
+		impl: b.impl.IteratorFrom(entry[T]{elem: elem}),
+	}
+}
+
+func (b *Bag[T]) AsTransient() *TBag[T] {
+	return &TBag[T]{
+		orig:  b,
+		impl:  b.impl.AsTransient(),
+		total: b.total,
+	}
+}
+
+type TBag[T any] struct {
+	orig  *Bag[T]
+	impl  *btree.TBTree[entry[T]]
+	total int
+}
+
+func (b *TBag[T]) Contains(elem T) bool {
+	return b.impl.Contains(entry[T]{elem: elem})
+}
+
+func (b *TBag[T]) Count(elem T) int {
+	return b.impl.At(entry[T]{elem: elem}).count
+}
+
+func (b *TBag[T]) Add(elem T, n int) *TBag[T] {
+	if n <= 0 {
+		return b
+	}
+	b.impl.AddFunc(entry[T]{elem: elem, count: n}, addCounts[T])
+	b.total += n
+	return b
+}
+
+func (b *TBag[T]) Remove(elem T, n int) *TBag[T] {
+	if n <= 0 {
+		return b
+	}
+	var removed int
+	b.impl.UpdateFunc(entry[T]{elem: elem}, removeCount[T](n, &removed))
+	b.total -= removed
+	return b
+}
+
+func (b *TBag[T]) Len() int {
+	return b.total
+}
+
+func (b *TBag[T]) Distinct() int {
+	return b.impl.Length()
+}
+
+func (b *TBag[T]) All() iter.Seq2[T, int] {
+	i := b.Iterator()
+	return i.Seq2
+}
+
+func (b *TBag[T]) From(elem T) iter.Seq2[T, int] {
+	i := b.IteratorFrom(elem)
+	return i.Seq2
+}
+
+func (b *TBag[T]) Iterator() Iterator[T] {
+	return Iterator[T]{
+		impl: b.impl.Iterator(),
+	}
+}
+
+func (b *TBag[T]) IteratorFrom(elem T) Iterator[T] {
+	return Iterator[T]{
+		impl: b.impl.IteratorFrom(entry[T]{elem: elem}),
+	}
+}
+
+func (b *TBag[T]) AsPersistent() *Bag[T] {
+	nimpl := b.impl.AsPersistent()
+	if nimpl == b.orig.impl {
+		return b.orig
+	}
+	return &Bag[T]{
+		impl:  nimpl,
+		total: b.total,
+	}
+}
+
+type Iterator[T any] struct {
+	impl btree.Iterator[entry[T]]
+}
+
+func (i *Iterator[T]) Seq2(yield func(elem T, count int) bool) {
+	for i.HasNext() {
+		if !yield(i.Next()) {
+			break
+		}
+	}
+}
+
+func (i *Iterator[T]) Next() (T, int) {
+	e := i.impl.Next()
+	return e.elem, e.count
+}
+
+func (i *Iterator[T]) HasNext() bool {
+	return i.impl.HasNext()
+}
+
+type entry[T any] struct {
+	elem  T
+	count int
+}
+
+// addCounts merges the occurrences being added into an entry already
+// in the bag.
+func addCounts[T any](old, new entry[T]) entry[T] {
+	return entry[T]{elem: old.elem, count: old.count + new.count}
+}
+
+// removeCount returns an update taking up to n occurrences out of an
+// entry, dropping it once none are left, and recording the number
+// taken in removed.
+func removeCount[T any](n int, removed *int) func(entry[T]) (entry[T], bool) {
+	return func(old entry[T]) (entry[T], bool) {
+		if n >= old.count {
+			*removed = old.count
+			return old, false
+		}
+		*removed = n
+		return entry[T]{elem: old.elem, count: old.count - n}, true
+	}
+}
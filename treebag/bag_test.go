@@ -0,0 +1,40 @@
+package treebag_test
+
+import (
+	"cmp"
+	"testing"
+
+	"jsouthworth.net/go/btree/treebag"
+)
+
+func TestCounts(t *testing.T) {
+	b1 := treebag.Empty(cmp.Compare[string]).
+		Add("b", 2).
+		Add("a", 1).
+		Add("b", 3)
+	b2 := b1.Remove("b", 4).Remove("a", 7).Remove("c", 1)
+	if b1.Count("b") != 5 || b1.Len() != 6 || b1.Distinct() != 2 {
+		t.Fatalf("b1: got count %v len %v distinct %v",
+			b1.Count("b"), b1.Len(), b1.Distinct())
+	}
+	if b2.Count("b") != 1 || b2.Contains("a") || b2.Len() != 1 {
+		t.Fatalf("b2: got count %v len %v", b2.Count("b"), b2.Len())
+	}
+
+	tb := b1.AsTransient()
+	for i := 0; i < 1000; i++ {
+		tb.Add("c", 1)
+	}
+	tb.Remove("a", 1)
+	b3 := tb.AsPersistent()
+	var elems []string
+	var total int
+	for elem, count := range b3.All() {
+		elems = append(elems, elem)
+		total += count
+	}
+	if len(elems) != 2 || elems[0] != "b" || elems[1] != "c" ||
+		total != b3.Len() || b3.Len() != 1005 {
+		t.Fatalf("b3: got elems %v total %v len %v", elems, total, b3.Len())
+	}
+}
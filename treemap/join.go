@@ -0,0 +1,118 @@
+package treemap
+
+import (
+	"iter"
+)
+
+// Joined is a key along with its values in the two maps of a join.
+// InLeft and InRight report whether the key is present in each map;
+// a missing value is the zero value.
+type Joined[K, L, R any] struct {
+	Key     K
+	Left    L
+	Right   R
+	InLeft  bool
+	InRight bool
+}
+
+// InnerJoin allows one to range over the keys present in both left
+// and right, in order. The maps must use the same ordering. Runs of
+// keys missing from either map are skipped with Seek, so joining a
+// small map with a large one costs O(m log n).
+func InnerJoin[K, L, R any](left *Map[K, L], right *Map[K, R]) iter.Seq[Joined[K, L, R]] {
+	return func(yield func(Joined[K, L, R]) bool) {
+		cmp := left.Comparator()
+		li, ri := left.Iterator(), right.Iterator()
+		lk, lv, lok := next(&li)
+		rk, rv, rok := next(&ri)
+		for lok && rok {
+			switch c := cmp(lk, rk); {
+			case c < 0:
+				li.Seek(rk)
+				lk, lv, lok = next(&li)
+			case c > 0:
+				ri.Seek(lk)
+				rk, rv, rok = next(&ri)
+			default:
+				if !yield(Joined[K, L, R]{
+					Key: lk, Left: lv, Right: rv,
+					InLeft: true, InRight: true,
+				}) {
+					return
+				}
+				lk, lv, lok = next(&li)
+				rk, rv, rok = next(&ri)
+			}
+		}
+	}
+}
+
+// LeftJoin allows one to range over every key of left, in order,
+// along with its value in right if there is one. Keys of right that
+// are missing from left are skipped with Seek.
+func LeftJoin[K, L, R any](left *Map[K, L], right *Map[K, R]) iter.Seq[Joined[K, L, R]] {
+	return func(yield func(Joined[K, L, R]) bool) {
+		cmp := left.Comparator()
+		li, ri := left.Iterator(), right.Iterator()
+		rk, rv, rok := next(&ri)
+		for li.HasNext() {
+			lk, lv := li.Next()
+			if rok && cmp(rk, lk) < 0 {
+				ri.Seek(lk)
+				rk, rv, rok = next(&ri)
+			}
+			j := Joined[K, L, R]{Key: lk, Left: lv, InLeft: true}
+			if rok && cmp(rk, lk) == 0 {
+				j.Right, j.InRight = rv, true
+				rk, rv, rok = next(&ri)
+			}
+			if !yield(j) {
+				return
+			}
+		}
+	}
+}
+
+// FullOuterJoin allows one to range over every key of left and right,
+// in order, along with its value in each map that contains it.
+func FullOuterJoin[K, L, R any](left *Map[K, L], right *Map[K, R]) iter.Seq[Joined[K, L, R]] {
+	return func(yield func(Joined[K, L, R]) bool) {
+		cmp := left.Comparator()
+		li, ri := left.Iterator(), right.Iterator()
+		lk, lv, lok := next(&li)
+		rk, rv, rok := next(&ri)
+		for lok || rok {
+			var j Joined[K, L, R]
+			c := 0
+			switch {
+			case !rok:
+				c = -1
+			case !lok:
+				c = 1
+			default:
+				c = cmp(lk, rk)
+			}
+			if c <= 0 {
+				j.Key, j.Left, j.InLeft = lk, lv, true
+				lk, lv, lok = next(&li)
+			}
+			if c >= 0 {
+				j.Key, j.Right, j.InRight = rk, rv, true
+				rk, rv, rok = next(&ri)
+			}
+			if !yield(j) {
+				return
+			}
+		}
+	}
+}
+
+func next[K, V any](i *Iterator[K, V]) (K, V, bool) {
+	if !i.HasNext() {
+		var k K
+		var v V
+		return k, v, false
+	}
+	k, v := i.Next()
+	return k, v, true
+}
@@ -0,0 +1,62 @@
+package treemap_test
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+func TestJoins(t *testing.T) {
+	left := treemap.Empty[int, int](cmp.Compare[int], eqInt).AsTransient()
+	for key := 0; key < 3000; key += 3 {
+		left.Assoc(key, key)
+	}
+	right := treemap.Empty[int, string](cmp.Compare[int],
+		func(a, b string) bool { return a == b }).AsTransient()
+	for key := 0; key < 4000; key += 5 {
+		right.Assoc(key, fmt.Sprint(key))
+	}
+	l, r := left.AsPersistent(), right.AsPersistent()
+
+	type row = treemap.Joined[int, int, string]
+	expect := func(keep func(inL, inR bool) bool) []row {
+		var out []row
+		for key := 0; key < 4000; key++ {
+			lv, inL := l.Find(key)
+			rv, inR := r.Find(key)
+			if (inL || inR) && keep(inL, inR) {
+				out = append(out, row{key, lv, rv, inL, inR})
+			}
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		got  []row
+		keep func(inL, inR bool) bool
+	}{
+		{"InnerJoin", slices.Collect(treemap.InnerJoin(l, r)),
+			func(inL, inR bool) bool { return inL && inR }},
+		{"LeftJoin", slices.Collect(treemap.LeftJoin(l, r)),
+			func(inL, inR bool) bool { return inL }},
+		{"FullOuterJoin", slices.Collect(treemap.FullOuterJoin(l, r)),
+			func(inL, inR bool) bool { return true }},
+	} {
+		if exp := expect(tc.keep); !slices.Equal(tc.got, exp) {
+			t.Errorf("%s: got %d rows expected %d", tc.name,
+				len(tc.got), len(exp))
+		}
+	}
+
+	empty := treemap.Empty[int, string](cmp.Compare[int],
+		func(a, b string) bool { return a == b })
+	if n := len(slices.Collect(treemap.InnerJoin(l, empty))); n != 0 {
+		t.Fatalf("InnerJoin with empty: got %v rows", n)
+	}
+	if n := len(slices.Collect(treemap.LeftJoin(l, empty))); n != 1000 {
+		t.Fatalf("LeftJoin with empty: got %v rows", n)
+	}
+}
@@ -58,6 +58,39 @@ func (m *Map[K,V]) Delete(key K) *Map[K,V] {
 	}
 }
 
+// Equal reports whether m and other contain the same keys with
+// values that are equal according to veq.
+func (m *Map[K,V]) Equal(other *Map[K,V], veq func(a, b V) bool) bool {
+	cmp := m.impl.Comparator()
+	return btree.EqualFunc(m.impl, other.impl, func(a, b entry[K,V]) bool {
+		return cmp(a, b) == 0 && veq(a.value, b.value)
+	})
+}
+
+// Comparator returns the function ordering the keys of the map.
+func (m *Map[K,V]) Comparator() func(a, b K) int {
+	cmp := m.impl.Comparator()
+	return func(a, b K) int {
+		return cmp(entry[K,V]{key: a}, entry[K,V]{key: b})
+	}
+}
+
+// WithObserver returns a map holding the same entries as m that
+// reports the work done by its edits to obs. See
+// btree.BTree.WithObserver.
+func (m *Map[K,V]) WithObserver(obs btree.Observer) *Map[K,V] {
+	return &Map[K,V]{impl: m.impl.WithObserver(obs)}
+}
+
+// WithBloom returns a map holding the same entries as m that checks a
+// bloom filter over its keys, hashed by hash, before searching for a
+// key. See btree.BTree.WithBloom.
+func (m *Map[K,V]) WithBloom(hash func(key K) uint64, fpRate float64) *Map[K,V] {
+	return &Map[K,V]{impl: m.impl.WithBloom(func(e entry[K,V]) uint64 {
+		return hash(e.key)
+	}, fpRate)}
+}
+
 func (m *Map[K,V]) Len(key K) int {
 	return m.impl.Length()
 }
@@ -84,6 +117,21 @@ func (m *Map[K,V]) IteratorFrom(key K) Iterator[K,V] {
 	}
 }
 
+func (m *Map[K,V]) Partitions(n int) []Range[K,V] {
+	parts := m.impl.Partitions(n)
+	out := make([]Range[K,V], len(parts))
+	for i, part := range parts {
+		out[i] = Range[K,V]{impl: part}
+	}
+	return out
+}
+
+func (m *Map[K,V]) ParallelForEach(n int, fn func(key K, value V)) {
+	m.impl.ParallelForEach(n, func(e entry[K,V]) {
+		fn(e.key, e.value)
+	})
+}
+
 func (m *Map[K,V]) AsTransient() *TMap[K,V] {
 	return &TMap[K,V]{
 		orig: m,
@@ -115,6 +163,18 @@ func (m *TMap[K,V]) Assoc(key K, value V) *TMap[K,V] {
 	return m
 }
 
+// TryAssoc is like Assoc but returns an error instead of panicking
+// if the transient has already been made persistent.
+func (m *TMap[K,V]) TryAssoc(key K, value V) error {
+	return m.impl.TryAdd(entry[K,V]{key:key, value:value})
+}
+
+// TryDelete is like Delete but returns an error instead of panicking
+// if the transient has already been made persistent.
+func (m *TMap[K,V]) TryDelete(key K) error {
+	return m.impl.TryDelete(entry[K,V]{key: key})
+}
+
 func (m *TMap[K,V]) Delete(key K) *TMap[K,V] {
 	m.impl.Delete(entry[K,V]{key: key})
 	return m
@@ -156,6 +216,46 @@ func (m *TMap[K,V]) AsPersistent() *Map[K,V] {
 	}
 }
 
+// TryAsPersistent is like AsPersistent but returns an error instead
+// of panicking if the transient has already been made persistent.
+func (m *TMap[K,V]) TryAsPersistent() (*Map[K,V], error) {
+	nimpl, err := m.impl.TryAsPersistent()
+	if err != nil {
+		return nil, err
+	}
+	if nimpl == m.orig.impl {
+		return m.orig, nil
+	}
+	return &Map[K,V]{
+		impl: nimpl,
+	}, nil
+}
+
+// Rollback discards every change made through the transient and
+// returns the map it was made from. See (*btree.TBTree[T]).Rollback.
+func (m *TMap[K,V]) Rollback() *Map[K,V] {
+	m.impl.Rollback()
+	return m.orig
+}
+
+// Savepoint is a state of a TMap that it may be rolled back to.
+type Savepoint[K,V any] struct {
+	impl *btree.Savepoint[entry[K,V]]
+}
+
+// Savepoint records the current state of the transient. See
+// (*btree.TBTree[T]).Savepoint.
+func (m *TMap[K,V]) Savepoint() Savepoint[K,V] {
+	return Savepoint[K,V]{impl: m.impl.Savepoint()}
+}
+
+// RollbackTo discards the changes made since sp was recorded. See
+// (*btree.TBTree[T]).RollbackTo.
+func (m *TMap[K,V]) RollbackTo(sp Savepoint[K,V]) *TMap[K,V] {
+	m.impl.RollbackTo(sp.impl)
+	return m
+}
+
 type Iterator[K,V any] struct {
 	impl btree.Iterator[entry[K,V]]
 }
@@ -178,6 +278,27 @@ func (i *Iterator[K,V]) HasNext() bool {
 	return i.impl.HasNext()
 }
 
+// Seek advances the iterator to the first remaining entry whose key is
+// greater than or equal to key. See (*btree.Iterator[T]).Seek.
+func (i *Iterator[K,V]) Seek(key K) {
+	i.impl.Seek(entry[K,V]{key: key})
+}
+
+type Range[K,V any] struct {
+	impl btree.Range[entry[K,V]]
+}
+
+func (r Range[K,V]) All() iter.Seq2[K,V] {
+	i := r.Iterator()
+	return i.Seq2
+}
+
+func (r Range[K,V]) Iterator() Iterator[K,V] {
+	return Iterator[K,V]{
+		impl: r.impl.Iterator(),
+	}
+}
+
 type entry[K, V any] struct {
 	key K
 	value V
@@ -0,0 +1,95 @@
+package treemap
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+// MergeIterator yields the entries of several map iterators as a
+// single stream ordered by key.
+type MergeIterator[K, V any] struct {
+	impl btree.MergeIterator[entry[K, V]]
+}
+
+// Merge returns an iterator over the entries of iters ordered by cmp,
+// which must be the ordering of the maps they were taken from. When
+// several iterators hold the same key, resolve folds their values
+// together in the order of the iterators; a nil resolve keeps the
+// value from the first of them.
+func Merge[K, V any](
+	cmp func(a, b K) int,
+	resolve func(key K, a, b V) V,
+	iters ...Iterator[K, V],
+) MergeIterator[K, V] {
+	var inline [4]btree.Iterator[entry[K, V]]
+	impls := inline[:0]
+	for _, i := range iters {
+		impls = append(impls, i.impl)
+	}
+	return MergeIterator[K, V]{
+		impl: btree.MergeFunc(entryCompare[K, V](cmp), entryCombine(resolve),
+			impls...),
+	}
+}
+
+func (i *MergeIterator[K, V]) Seq2(yield func(key K, value V) bool) {
+	for i.HasNext() {
+		k, v := i.Next()
+		if !yield(k, v) {
+			break
+		}
+	}
+}
+
+func (i *MergeIterator[K, V]) Next() (K, V) {
+	e := i.impl.Next()
+	return e.key, e.value
+}
+
+func (i *MergeIterator[K, V]) HasNext() bool {
+	return i.impl.HasNext()
+}
+
+// MergeSeq is like Merge for sequences. Each of seqs must already be
+// ordered by cmp.
+func MergeSeq[K, V any](
+	cmp func(a, b K) int,
+	resolve func(key K, a, b V) V,
+	seqs ...iter.Seq2[K, V],
+) iter.Seq2[K, V] {
+	entries := make([]iter.Seq[entry[K, V]], len(seqs))
+	for i, seq := range seqs {
+		entries[i] = func(yield func(entry[K, V]) bool) {
+			for k, v := range seq {
+				if !yield(entry[K, V]{key: k, value: v}) {
+					return
+				}
+			}
+		}
+	}
+	merged := btree.MergeSeqFunc(entryCompare[K, V](cmp), entryCombine(resolve),
+		entries...)
+	return func(yield func(K, V) bool) {
+		for e := range merged {
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+func entryCompare[K, V any](cmp func(a, b K) int) func(a, b entry[K, V]) int {
+	return func(a, b entry[K, V]) int {
+		return cmp(a.key, b.key)
+	}
+}
+
+func entryCombine[K, V any](resolve func(key K, a, b V) V) func(a, b entry[K, V]) entry[K, V] {
+	if resolve == nil {
+		return btree.KeepFirst[entry[K, V]]
+	}
+	return func(a, b entry[K, V]) entry[K, V] {
+		return entry[K, V]{key: a.key, value: resolve(a.key, a.value, b.value)}
+	}
+}
@@ -0,0 +1,103 @@
+package treemap
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Conflict describes a key that ours and theirs both changed relative
+// to base, but in different ways. The In fields report whether the
+// key is present in each version; a missing value is the zero value.
+type Conflict[K, V any] struct {
+	Key      K
+	Base     V
+	Ours     V
+	Theirs   V
+	InBase   bool
+	InOurs   bool
+	InTheirs bool
+}
+
+// Merge3 reconciles two versions of a map, ours and theirs, that were
+// both derived from base. Changes made on only one side are applied.
+// A key changed on both sides is kept if both made the same change
+// and is otherwise a conflict. Changes are found by diffing each side
+// against base, so subtrees shared with base are never visited.
+//
+// Conflicts are passed to resolve, which returns the value to store
+// and false if the key should be removed instead. If resolve is nil
+// conflicting keys keep their value from ours and the conflicts are
+// returned.
+func Merge3[K, V any](
+	base, ours, theirs *Map[K, V],
+	resolve func(c Conflict[K, V]) (V, bool),
+) (*Map[K, V], []Conflict[K, V]) {
+	cmp := base.impl.Comparator()
+	eq := base.impl.Equality()
+	out := ours.AsTransient()
+	var conflicts []Conflict[K, V]
+
+	nextOurs, stop := iter.Pull(btree.Diff(base.impl, ours.impl))
+	defer stop()
+	o, oursOK := nextOurs()
+	for t := range btree.Diff(base.impl, theirs.impl) {
+		key := changed(t)
+		for oursOK && cmp(changed(o), key) < 0 {
+			o, oursOK = nextOurs()
+		}
+		if !oursOK || cmp(changed(o), key) != 0 {
+			apply(out, t)
+			continue
+		}
+		oe, inOurs := result(o)
+		te, inTheirs := result(t)
+		if inOurs == inTheirs && (!inOurs || eq(oe, te)) {
+			continue
+		}
+		c := Conflict[K, V]{
+			Key:      key.key,
+			Ours:     oe.value,
+			Theirs:   te.value,
+			InOurs:   inOurs,
+			InTheirs: inTheirs,
+		}
+		if t.Kind != btree.Added {
+			c.Base, c.InBase = t.Old.value, true
+		}
+		if resolve == nil {
+			conflicts = append(conflicts, c)
+			continue
+		}
+		if value, keep := resolve(c); keep {
+			out.Assoc(c.Key, value)
+		} else {
+			out.Delete(c.Key)
+		}
+	}
+	return out.AsPersistent(), conflicts
+}
+
+// changed returns the entry whose key a change applies to.
+func changed[K, V any](c btree.Change[entry[K, V]]) entry[K, V] {
+	if c.Kind == btree.Removed {
+		return c.Old
+	}
+	return c.New
+}
+
+// result returns the entry after a change and whether it is present.
+func result[K, V any](c btree.Change[entry[K, V]]) (entry[K, V], bool) {
+	if c.Kind == btree.Removed {
+		return entry[K, V]{}, false
+	}
+	return c.New, true
+}
+
+func apply[K, V any](m *TMap[K, V], c btree.Change[entry[K, V]]) {
+	if c.Kind == btree.Removed {
+		m.Delete(c.Old.key)
+		return
+	}
+	m.Assoc(c.New.key, c.New.value)
+}
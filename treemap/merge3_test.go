@@ -0,0 +1,108 @@
+package treemap_test
+
+import (
+	"cmp"
+	"math/rand"
+	"testing"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+func TestMerge3(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		base := treemap.Empty[int, int](cmp.Compare[int], eqInt).AsTransient()
+		baseVals := map[int]int{}
+		for key := 0; key < 2000; key++ {
+			base.Assoc(key, 0)
+			baseVals[key] = 0
+		}
+		b := base.AsPersistent()
+		// Each side edits a few random keys; some keys are
+		// edited by both, sometimes in the same way.
+		edit := func() (*treemap.Map[int, int], map[int]int) {
+			m := b.AsTransient()
+			vals := map[int]int{}
+			for k, v := range baseVals {
+				vals[k] = v
+			}
+			for n := 0; n < 40; n++ {
+				key := r.Intn(2100)
+				switch r.Intn(3) {
+				case 0:
+					m.Delete(key)
+					delete(vals, key)
+				default:
+					v := 1 + r.Intn(2)
+					m.Assoc(key, v)
+					vals[key] = v
+				}
+			}
+			return m.AsPersistent(), vals
+		}
+		ours, oursVals := edit()
+		theirs, theirsVals := edit()
+
+		expected := map[int]int{}
+		conflicts := map[int]bool{}
+		for key := 0; key < 2100; key++ {
+			bv, inB := baseVals[key]
+			ov, inO := oursVals[key]
+			tv, inT := theirsVals[key]
+			oursChanged := inO != inB || ov != bv
+			theirsChanged := inT != inB || tv != bv
+			switch {
+			case theirsChanged && oursChanged &&
+				(inO != inT || ov != tv):
+				conflicts[key] = true
+				// The resolver below keeps the larger value.
+				v := max(ov, tv)
+				if inO || inT {
+					expected[key] = v
+				}
+			case theirsChanged:
+				if inT {
+					expected[key] = tv
+				}
+			default:
+				if inO {
+					expected[key] = ov
+				}
+			}
+		}
+
+		resolved := map[int]bool{}
+		merged, rest := treemap.Merge3(b, ours, theirs,
+			func(c treemap.Conflict[int, int]) (int, bool) {
+				bv, inB := baseVals[c.Key]
+				if c.InBase != inB || c.Base != bv {
+					t.Fatalf("conflict %v has wrong base", c)
+				}
+				resolved[c.Key] = true
+				return max(c.Ours, c.Theirs), c.InOurs || c.InTheirs
+			})
+		if len(rest) != 0 {
+			t.Fatalf("got %v unresolved conflicts", len(rest))
+		}
+		if len(resolved) != len(conflicts) {
+			t.Fatalf("got %v conflicts expected %v",
+				len(resolved), len(conflicts))
+		}
+		var n int
+		for k, v := range merged.All() {
+			if ev, ok := expected[k]; !ok || ev != v {
+				t.Fatalf("key %v: got %v expected %v %v", k, v, ev, ok)
+			}
+			n++
+		}
+		if n != len(expected) {
+			t.Fatalf("got %v keys expected %v", n, len(expected))
+		}
+
+		_, unresolved := treemap.Merge3(b, ours, theirs, nil)
+		if len(unresolved) != len(conflicts) {
+			t.Fatalf("got %v conflicts expected %v",
+				len(unresolved), len(conflicts))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package treemap_test
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+func TestMerge(t *testing.T) {
+	var shards []*treemap.Map[int, int]
+	for s := 1; s <= 6; s++ {
+		m := treemap.Empty[int, int](cmp.Compare[int], eqInt)
+		for key := 0; key < 30; key += s {
+			m = m.Assoc(key, 1)
+		}
+		shards = append(shards, m)
+	}
+	expected := func(key int) int {
+		var n int
+		for s := 1; s <= 6; s++ {
+			if key%s == 0 {
+				n++
+			}
+		}
+		return n
+	}
+	sum := func(key, a, b int) int { return a + b }
+
+	var iters []treemap.Iterator[int, int]
+	for _, m := range shards {
+		iters = append(iters, m.Iterator())
+	}
+	mi := treemap.Merge(cmp.Compare[int], sum, iters...)
+	var keys []int
+	for key, n := range mi.Seq2 {
+		if n != expected(key) {
+			t.Fatalf("Merge: key %v got %v expected %v", key, n, expected(key))
+		}
+		keys = append(keys, key)
+	}
+	if !slices.Equal(keys, slices.Collect(ints(30))) {
+		t.Fatalf("Merge: got keys %v", keys)
+	}
+
+	var n int
+	for key, v := range treemap.MergeSeq(cmp.Compare[int], nil,
+		shards[5].All(), shards[1].All()) {
+		if key%2 != 0 && key%6 != 0 || v != 1 {
+			t.Fatalf("MergeSeq: got %v %v", key, v)
+		}
+		n++
+	}
+	if n != 15 {
+		t.Fatalf("MergeSeq: got %v keys expected 15", n)
+	}
+}
+
+func ints(n int) func(func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package treemap
+
+import (
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Ref is a shared holder for a Map. Readers obtain the current
+// version with Deref while writers replace it with Reset or Update.
+// Every replacement is diffed against the previous version and the
+// changed keys are delivered to the subscribers watching them.
+type Ref[K, V any] struct {
+	cur atomic.Pointer[Map[K, V]]
+
+	// writeMu serializes replacements so subscribers see batches
+	// in the order the versions were installed.
+	writeMu sync.Mutex
+
+	subsMu sync.Mutex
+	subs   []*Subscription[K, V]
+}
+
+func NewRef[K, V any](m *Map[K, V]) *Ref[K, V] {
+	r := &Ref[K, V]{}
+	r.cur.Store(m)
+	return r
+}
+
+// Deref returns the current version of the map.
+func (r *Ref[K, V]) Deref() *Map[K, V] {
+	return r.cur.Load()
+}
+
+// Reset installs m as the current version and returns the previous
+// one. Reset blocks until every interested subscriber has accepted
+// its batch of changes.
+func (r *Ref[K, V]) Reset(m *Map[K, V]) *Map[K, V] {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	old := r.cur.Swap(m)
+	r.publish(old, m)
+	return old
+}
+
+// Update installs the result of calling fn on the current version and
+// returns it. Writers are serialized so fn always sees the latest
+// version.
+func (r *Ref[K, V]) Update(fn func(*Map[K, V]) *Map[K, V]) *Map[K, V] {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	old := r.cur.Load()
+	new := fn(old)
+	r.cur.Store(new)
+	r.publish(old, new)
+	return new
+}
+
+// Subscribe registers interest in changes to the keys between lo and
+// hi inclusive. Batches of changes are delivered on the channel
+// returned by (*Subscription).C which holds up to buffer batches;
+// once it is full writers block until the subscriber catches up.
+func (r *Ref[K, V]) Subscribe(lo, hi K, buffer int) *Subscription[K, V] {
+	return r.subscribe(&Subscription[K, V]{
+		lo: lo, hi: hi, bounded: true,
+		ch: make(chan []Event[K, V], buffer),
+	})
+}
+
+// SubscribeAll is like Subscribe for every key in the map.
+func (r *Ref[K, V]) SubscribeAll(buffer int) *Subscription[K, V] {
+	return r.subscribe(&Subscription[K, V]{
+		ch: make(chan []Event[K, V], buffer),
+	})
+}
+
+// SubscribeFunc registers fn to be called with every batch of
+// changes to the keys between lo and hi inclusive. fn is called from
+// the writer's goroutine, so the writer waits for it to return.
+func (r *Ref[K, V]) SubscribeFunc(lo, hi K, fn func([]Event[K, V])) *Subscription[K, V] {
+	return r.subscribe(&Subscription[K, V]{
+		lo: lo, hi: hi, bounded: true,
+		fn: fn,
+	})
+}
+
+// SubscribeAllFunc is like SubscribeFunc for every key in the map.
+func (r *Ref[K, V]) SubscribeAllFunc(fn func([]Event[K, V])) *Subscription[K, V] {
+	return r.subscribe(&Subscription[K, V]{
+		fn: fn,
+	})
+}
+
+func (r *Ref[K, V]) subscribe(s *Subscription[K, V]) *Subscription[K, V] {
+	s.ref = r
+	s.done = make(chan struct{})
+	r.subsMu.Lock()
+	r.subs = append(r.subs, s)
+	r.subsMu.Unlock()
+	return s
+}
+
+func (r *Ref[K, V]) unsubscribe(s *Subscription[K, V]) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	r.subs = slices.DeleteFunc(r.subs, func(o *Subscription[K, V]) bool {
+		return o == s
+	})
+}
+
+func (r *Ref[K, V]) publish(old, new *Map[K, V]) {
+	r.subsMu.Lock()
+	subs := slices.Clone(r.subs)
+	r.subsMu.Unlock()
+	if len(subs) == 0 {
+		return
+	}
+	events := slices.Collect(diff(old, new))
+	if len(events) == 0 {
+		return
+	}
+	cmp := new.impl.Comparator()
+	for _, s := range subs {
+		if batch := s.filter(events, cmp); len(batch) > 0 {
+			s.deliver(batch)
+		}
+	}
+}
+
+// Event describes the change of a single key between two versions of
+// a map. Old is set for Removed and Updated events and New for Added
+// and Updated ones.
+type Event[K, V any] struct {
+	Kind btree.ChangeKind
+	Key  K
+	Old  V
+	New  V
+}
+
+// Subscription is a registration for change events created by one
+// of the Subscribe methods of Ref.
+type Subscription[K, V any] struct {
+	ref     *Ref[K, V]
+	lo, hi  K
+	bounded bool
+
+	fn func([]Event[K, V])
+
+	// sendMu is held while sending on ch so that Unsubscribe can
+	// close it without racing a writer.
+	sendMu sync.Mutex
+	ch     chan []Event[K, V]
+
+	done chan struct{}
+	once sync.Once
+}
+
+// C returns the channel batches are delivered on. It is nil for
+// subscriptions created with a callback and is closed by
+// Unsubscribe.
+func (s *Subscription[K, V]) C() <-chan []Event[K, V] {
+	return s.ch
+}
+
+// Unsubscribe stops the delivery of further batches. A writer
+// blocked delivering to this subscription is released. It is safe
+// to call Unsubscribe more than once and from within a callback.
+func (s *Subscription[K, V]) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.done)
+		s.ref.unsubscribe(s)
+		if s.ch != nil {
+			s.sendMu.Lock()
+			close(s.ch)
+			s.sendMu.Unlock()
+		}
+	})
+}
+
+func (s *Subscription[K, V]) filter(
+	events []Event[K, V],
+	cmp func(a, b entry[K, V]) int,
+) []Event[K, V] {
+	if !s.bounded {
+		return events
+	}
+	var batch []Event[K, V]
+	for _, ev := range events {
+		key := entry[K, V]{key: ev.Key}
+		if cmp(key, entry[K, V]{key: s.lo}) >= 0 &&
+			cmp(key, entry[K, V]{key: s.hi}) <= 0 {
+			batch = append(batch, ev)
+		}
+	}
+	return batch
+}
+
+func (s *Subscription[K, V]) deliver(batch []Event[K, V]) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	if s.fn != nil {
+		s.fn(batch)
+		return
+	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	// ch is only closed after done with sendMu held, so it is
+	// still open if done is not closed yet.
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	select {
+	case s.ch <- batch:
+	case <-s.done:
+	}
+}
+
+func diff[K, V any](old, new *Map[K, V]) iter.Seq[Event[K, V]] {
+	return func(yield func(Event[K, V]) bool) {
+		for c := range btree.Diff(old.impl, new.impl) {
+			ev := Event[K, V]{Kind: c.Kind, Old: c.Old.value, New: c.New.value}
+			if c.Kind == btree.Removed {
+				ev.Key = c.Old.key
+			} else {
+				ev.Key = c.New.key
+			}
+			if !yield(ev) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package treemap_test
+
+import (
+	"cmp"
+	"testing"
+	"time"
+
+	"jsouthworth.net/go/btree"
+	"jsouthworth.net/go/btree/treemap"
+)
+
+func eqInt(a, b int) bool {
+	return a == b
+}
+
+func TestRefSubscribe(t *testing.T) {
+	m := treemap.Empty[int, int](cmp.Compare[int], eqInt).AsTransient()
+	for i := 0; i < 10000; i++ {
+		m.Assoc(i, i)
+	}
+	ref := treemap.NewRef(m.AsPersistent())
+	sub := ref.Subscribe(100, 199, 1)
+	var all [][]treemap.Event[int, int]
+	ref.SubscribeAllFunc(func(batch []treemap.Event[int, int]) {
+		all = append(all, batch)
+	})
+
+	ref.Update(func(m *treemap.Map[int, int]) *treemap.Map[int, int] {
+		return m.Assoc(150, -1).Delete(5000).Assoc(20000, 1)
+	})
+	batch := <-sub.C()
+	if len(batch) != 1 || batch[0].Kind != btree.Updated ||
+		batch[0].Key != 150 || batch[0].Old != 150 || batch[0].New != -1 {
+		t.Fatalf("got batch %v", batch)
+	}
+	if len(all) != 1 || len(all[0]) != 3 ||
+		all[0][1].Kind != btree.Removed || all[0][2].Kind != btree.Added {
+		t.Fatalf("got batches %v", all)
+	}
+
+	// Changes outside of the range are not delivered.
+	ref.Update(func(m *treemap.Map[int, int]) *treemap.Map[int, int] {
+		return m.Delete(1)
+	})
+	select {
+	case batch := <-sub.C():
+		t.Fatalf("got unexpected batch %v", batch)
+	default:
+	}
+
+	// Fill the buffer, then check that a blocked writer is released
+	// by Unsubscribe.
+	ref.Update(func(m *treemap.Map[int, int]) *treemap.Map[int, int] {
+		return m.Delete(100)
+	})
+	released := make(chan struct{})
+	go func() {
+		ref.Update(func(m *treemap.Map[int, int]) *treemap.Map[int, int] {
+			return m.Delete(101)
+		})
+		close(released)
+	}()
+	select {
+	case <-released:
+		t.Fatal("writer was not blocked by a full subscriber")
+	case <-time.After(10 * time.Millisecond):
+	}
+	sub.Unsubscribe()
+	<-released
+	for range sub.C() {
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %v batches expected 4", len(all))
+	}
+}
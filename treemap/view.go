@@ -0,0 +1,153 @@
+package treemap
+
+import (
+	"iter"
+)
+
+// View is a read-only view of the entries of a Map whose keys lie in a
+// range. Views are created with SubMap, HeadMap and TailMap and share
+// the nodes of the map; nothing is copied. Lower bounds are inclusive
+// and upper bounds are exclusive.
+type View[K, V any] struct {
+	m      *Map[K, V]
+	cmp    func(a, b K) int
+	lo, hi bound[K]
+}
+
+// bound is one end of a View's range. ok is false if the range is
+// unbounded at that end.
+type bound[K any] struct {
+	key K
+	ok  bool
+}
+
+// SubMap returns a view of the entries whose keys are at least lo and
+// below hi.
+func (m *Map[K, V]) SubMap(lo, hi K) View[K, V] {
+	return m.view().SubMap(lo, hi)
+}
+
+// HeadMap returns a view of the entries whose keys are below hi.
+func (m *Map[K, V]) HeadMap(hi K) View[K, V] {
+	return m.view().HeadMap(hi)
+}
+
+// TailMap returns a view of the entries whose keys are at least lo.
+func (m *Map[K, V]) TailMap(lo K) View[K, V] {
+	return m.view().TailMap(lo)
+}
+
+func (m *Map[K, V]) view() View[K, V] {
+	return View[K, V]{m: m, cmp: m.Comparator()}
+}
+
+// SubMap narrows the view to the keys that are also at least lo and
+// below hi.
+func (v View[K, V]) SubMap(lo, hi K) View[K, V] {
+	return v.TailMap(lo).HeadMap(hi)
+}
+
+// HeadMap narrows the view to the keys that are also below hi.
+func (v View[K, V]) HeadMap(hi K) View[K, V] {
+	if !v.hi.ok || v.cmp(hi, v.hi.key) < 0 {
+		v.hi = bound[K]{key: hi, ok: true}
+	}
+	return v
+}
+
+// TailMap narrows the view to the keys that are also at least lo.
+func (v View[K, V]) TailMap(lo K) View[K, V] {
+	if !v.lo.ok || v.cmp(lo, v.lo.key) > 0 {
+		v.lo = bound[K]{key: lo, ok: true}
+	}
+	return v
+}
+
+func (v View[K, V]) Contains(key K) bool {
+	return v.inRange(key) && v.m.Contains(key)
+}
+
+func (v View[K, V]) Find(key K) (V, bool) {
+	if !v.inRange(key) {
+		var zero V
+		return zero, false
+	}
+	return v.m.Find(key)
+}
+
+// Len returns the number of entries in the view. This is O(1) for an
+// unbounded view and otherwise counts the entries in range.
+func (v View[K, V]) Len() int {
+	if !v.lo.ok && !v.hi.ok {
+		return v.m.impl.Length()
+	}
+	var n int
+	for range v.All() {
+		n++
+	}
+	return n
+}
+
+// Min returns the entry with the smallest key in the view. The
+// boolean is false if the view is empty.
+func (v View[K, V]) Min() (K, V, bool) {
+	i := v.m.Iterator()
+	if v.lo.ok {
+		i = v.m.IteratorFrom(v.lo.key)
+	}
+	if !i.HasNext() {
+		return v.none()
+	}
+	k, val := i.Next()
+	if !v.belowHi(k) {
+		return v.none()
+	}
+	return k, val, true
+}
+
+// Max returns the entry with the largest key in the view. The boolean
+// is false if the view is empty.
+func (v View[K, V]) Max() (K, V, bool) {
+	e, ok := v.m.impl.Max()
+	if v.hi.ok {
+		e, ok = v.m.impl.Lower(entry[K, V]{key: v.hi.key})
+	}
+	if !ok || !v.aboveLo(e.key) {
+		return v.none()
+	}
+	return e.key, e.value, true
+}
+
+// All allows one to range over the entries of the view in order.
+func (v View[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		i := v.m.Iterator()
+		if v.lo.ok {
+			i = v.m.IteratorFrom(v.lo.key)
+		}
+		for i.HasNext() {
+			k, val := i.Next()
+			if !v.belowHi(k) || !yield(k, val) {
+				return
+			}
+		}
+	}
+}
+
+func (v View[K, V]) inRange(key K) bool {
+	return v.aboveLo(key) && v.belowHi(key)
+}
+
+func (v View[K, V]) aboveLo(key K) bool {
+	return !v.lo.ok || v.cmp(key, v.lo.key) >= 0
+}
+
+func (v View[K, V]) belowHi(key K) bool {
+	return !v.hi.ok || v.cmp(key, v.hi.key) < 0
+}
+
+func (v View[K, V]) none() (K, V, bool) {
+	var k K
+	var val V
+	return k, val, false
+}
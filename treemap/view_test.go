@@ -0,0 +1,55 @@
+package treemap_test
+
+import (
+	"cmp"
+	"testing"
+
+	"jsouthworth.net/go/btree/treemap"
+)
+
+func TestView(t *testing.T) {
+	tm := treemap.Empty[int, int](cmp.Compare[int], eqInt).AsTransient()
+	for key := 0; key < 1000; key += 2 {
+		tm.Assoc(key, -key)
+	}
+	m := tm.AsPersistent()
+
+	v := m.SubMap(100, 200)
+	if v.Len() != 50 || v.Contains(200) || !v.Contains(100) ||
+		v.Contains(98) || m.TailMap(0).Len() != 500 {
+		t.Fatalf("got len %v", v.Len())
+	}
+	if val, ok := v.Find(150); !ok || val != -150 {
+		t.Fatalf("Find(150): got %v %v", val, ok)
+	}
+	if _, ok := v.Find(300); ok {
+		t.Fatal("Find(300) found a key outside the view")
+	}
+	if k, _, ok := v.Min(); !ok || k != 100 {
+		t.Fatalf("Min: got %v %v", k, ok)
+	}
+	if k, _, ok := v.Max(); !ok || k != 198 {
+		t.Fatalf("Max: got %v %v", k, ok)
+	}
+
+	// Narrowing intersects with the existing range.
+	n := v.HeadMap(151).TailMap(50).SubMap(120, 500)
+	var keys []int
+	for k := range n.All() {
+		keys = append(keys, k)
+	}
+	if len(keys) != 16 || keys[0] != 120 || keys[15] != 150 {
+		t.Fatalf("narrowed keys: got %v", keys)
+	}
+
+	empty := m.SubMap(101, 102)
+	if _, _, ok := empty.Min(); ok {
+		t.Fatal("Min of empty view succeeded")
+	}
+	if _, _, ok := empty.Max(); ok {
+		t.Fatal("Max of empty view succeeded")
+	}
+	if k, _, ok := m.HeadMap(1000000).Max(); !ok || k != 998 {
+		t.Fatalf("Max of head view: got %v %v", k, ok)
+	}
+}
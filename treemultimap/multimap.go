@@ -0,0 +1,325 @@
+// Package treemultimap implements a persistent sorted multimap. Each
+// key may be associated with any number of distinct values; pairs
+// are ordered by key and then by value. Each distinct key is stored
+// once together with the sorted set of its values.
+package treemultimap
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+type Map[K, V any] struct {
+	impl  *btree.BTree[entry[K, V]]
+	len   int
+	empty *btree.BTree[V]
+}
+
+func Empty[K, V any](kcmp func(a, b K) int, vcmp func(a, b V) int) *Map[K, V] {
+	return &Map[K, V]{
+		impl: btree.Empty[entry[K, V]](
+			func(a, b entry[K, V]) int {
+				return kcmp(a.key, b.key)
+			},
+			func(a, b entry[K, V]) bool {
+				return kcmp(a.key, b.key) == 0 &&
+					a.values == b.values
+			},
+		),
+		empty: btree.Empty[V](
+			vcmp,
+			func(a, b V) bool {
+				return vcmp(a, b) == 0
+			},
+		),
+	}
+}
+
+func (m *Map[K, V]) Contains(key K, value V) bool {
+	e, ok := m.impl.Find(entry[K, V]{key: key})
+	return ok && e.values.Contains(value)
+}
+
+func (m *Map[K, V]) ContainsKey(key K) bool {
+	return m.impl.Contains(entry[K, V]{key: key})
+}
+
+// Put returns a multimap that associates value with key in addition
+// to any values already associated with it.
+func (m *Map[K, V]) Put(key K, value V) *Map[K, V] {
+	added := 1
+	nimpl := m.impl.AddFunc(entry[K, V]{key: key, values: m.empty.Add(value)},
+		addValue[K, V](value, &added))
+	if nimpl == m.impl {
+		return m
+	}
+	return &Map[K, V]{
+		impl:  nimpl,
+		len:   m.len + added,
+		empty: m.empty,
+	}
+}
+
+// Remove returns a multimap without the association between key and
+// value.
+func (m *Map[K, V]) Remove(key K, value V) *Map[K, V] {
+	var removed int
+	nimpl := m.impl.UpdateFunc(entry[K, V]{key: key}, removeValue[K, V](value, &removed))
+	if removed == 0 {
+		return m
+	}
+	return &Map[K, V]{
+		impl:  nimpl,
+		len:   m.len - removed,
+		empty: m.empty,
+	}
+}
+
+// RemoveAll returns a multimap without any of the values associated
+// with key.
+func (m *Map[K, V]) RemoveAll(key K) *Map[K, V] {
+	var removed int
+	nimpl := m.impl.UpdateFunc(entry[K, V]{key: key}, removeAll[K, V](&removed))
+	if nimpl == m.impl {
+		return m
+	}
+	return &Map[K, V]{
+		impl:  nimpl,
+		len:   m.len - removed,
+		empty: m.empty,
+	}
+}
+
+// Values allows one to range over the values associated with key in
+// order.
+func (m *Map[K, V]) Values(key K) iter.Seq[V] {
+	return values(m.impl.Find(entry[K, V]{key: key}))
+}
+
+// Len returns the number of key value pairs in the multimap.
+func (m *Map[K, V]) Len() int {
+	return m.len
+}
+
+// KeyLen returns the number of distinct keys in the multimap.
+func (m *Map[K, V]) KeyLen() int {
+	return m.impl.Length()
+}
+
+// All allows one to range over every key value pair in order.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	i := m.Iterator()
+	return i.Seq2
+}
+
+// Keys allows one to range over the distinct keys in order.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return keys(m.impl.Iterator())
+}
+
+func (m *Map[K, V]) From(key K) iter.Seq2[K, V] {
+	i := m.IteratorFrom(key)
+	return i.Seq2
+}
+
+func (m *Map[K, V]) Iterator() Iterator[K, V] {
+	return Iterator[K, V]{
+		impl: m.impl.Iterator(),
+	}
+}
+
+func (m *Map[K, V]) IteratorFrom(key K) Iterator[K, V] {
+	return Iterator[K, V]{
+		impl: m.impl.IteratorFrom(entry[K, V]{key: key}),
+	}
+}
+
+func (m *Map[K, V]) AsTransient() *TMap[K, V] {
+	return &TMap[K, V]{
+		orig:  m,
+		impl:  m.impl.AsTransient(),
+		len:   m.len,
+		empty: m.empty,
+	}
+}
+
+type TMap[K, V any] struct {
+	orig  *Map[K, V]
+	impl  *btree.TBTree[entry[K, V]]
+	len   int
+	empty *btree.BTree[V]
+}
+
+func (m *TMap[K, V]) Contains(key K, value V) bool {
+	e, ok := m.impl.Find(entry[K, V]{key: key})
+	return ok && e.values.Contains(value)
+}
+
+func (m *TMap[K, V]) ContainsKey(key K) bool {
+	return m.impl.Contains(entry[K, V]{key: key})
+}
+
+func (m *TMap[K, V]) Put(key K, value V) *TMap[K, V] {
+	added := 1
+	m.impl.AddFunc(entry[K, V]{key: key, values: m.empty.Add(value)},
+		addValue[K, V](value, &added))
+	m.len += added
+	return m
+}
+
+func (m *TMap[K, V]) Remove(key K, value V) *TMap[K, V] {
+	var removed int
+	m.impl.UpdateFunc(entry[K, V]{key: key}, removeValue[K, V](value, &removed))
+	m.len -= removed
+	return m
+}
+
+func (m *TMap[K, V]) RemoveAll(key K) *TMap[K, V] {
+	var removed int
+	m.impl.UpdateFunc(entry[K, V]{key: key}, removeAll[K, V](&removed))
+	m.len -= removed
+	return m
+}
+
+func (m *TMap[K, V]) Values(key K) iter.Seq[V] {
+	return values(m.impl.Find(entry[K, V]{key: key}))
+}
+
+func (m *TMap[K, V]) Len() int {
+	return m.len
+}
+
+func (m *TMap[K, V]) KeyLen() int {
+	return m.impl.Length()
+}
+
+func (m *TMap[K, V]) All() iter.Seq2[K, V] {
+	i := m.Iterator()
+	return i.Seq2
+}
+
+func (m *TMap[K, V]) Keys() iter.Seq[K] {
+	return keys(m.impl.Iterator())
+}
+
+func (m *TMap[K, V]) From(key K) iter.Seq2[K, V] {
+	i := m.IteratorFrom(key)
+	return i.Seq2
+}
+
+func (m *TMap[K, V]) Iterator() Iterator[K, V] {
+	return Iterator[K, V]{
+		impl: m.impl.Iterator(),
+	}
+}
+
+func (m *TMap[K, V]) IteratorFrom(key K) Iterator[K, V] {
+	return Iterator[K, V]{
+		impl: m.impl.IteratorFrom(entry[K, V]{key: key}),
+	}
+}
+
+func (m *TMap[K, V]) AsPersistent() *Map[K, V] {
+	nimpl := m.impl.AsPersistent()
+	if nimpl == m.orig.impl {
+		return m.orig
+	}
+	return &Map[K, V]{
+		impl:  nimpl,
+		len:   m.len,
+		empty: m.empty,
+	}
+}
+
+type Iterator[K, V any] struct {
+	impl   btree.Iterator[entry[K, V]]
+	key    K
+	values btree.Iterator[V]
+	inKey  bool
+}
+
+func (i *Iterator[K, V]) Seq2(yield func(key K, value V) bool) {
+	for i.HasNext() {
+		if !yield(i.Next()) {
+			break
+		}
+	}
+}
+
+func (i *Iterator[K, V]) Next() (K, V) {
+	return i.key, i.values.Next()
+}
+
+func (i *Iterator[K, V]) HasNext() bool {
+	for !i.inKey || !i.values.HasNext() {
+		if !i.impl.HasNext() {
+			return false
+		}
+		e := i.impl.Next()
+		i.key, i.values, i.inKey = e.key, e.values.Iterator(), true
+	}
+	return true
+}
+
+func values[K, V any](e entry[K, V], ok bool) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		if ok {
+			e.values.All()(yield)
+		}
+	}
+}
+
+func keys[K, V any](i btree.Iterator[entry[K, V]]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for i.HasNext() {
+			if !yield(i.Next().key) {
+				return
+			}
+		}
+	}
+}
+
+// addValue adds value to the values already stored for a key. The
+// old entry is returned, and added cleared, if value is already
+// present.
+func addValue[K, V any](value V, added *int) func(old, new entry[K, V]) entry[K, V] {
+	return func(old, new entry[K, V]) entry[K, V] {
+		values := old.values.Add(value)
+		if values == old.values {
+			*added = 0
+			return old
+		}
+		return entry[K, V]{key: old.key, values: values}
+	}
+}
+
+// removeValue removes value from the values stored for a key and
+// records in removed whether it was present. The entry is dropped
+// once its last value is removed.
+func removeValue[K, V any](value V, removed *int) func(old entry[K, V]) (entry[K, V], bool) {
+	return func(old entry[K, V]) (entry[K, V], bool) {
+		values := old.values.Delete(value)
+		if values == old.values {
+			return old, true
+		}
+		*removed = 1
+		return entry[K, V]{key: old.key, values: values}, values.Length() > 0
+	}
+}
+
+// removeAll drops the entry for a key and records how many values it
+// held in removed.
+func removeAll[K, V any](removed *int) func(old entry[K, V]) (entry[K, V], bool) {
+	return func(old entry[K, V]) (entry[K, V], bool) {
+		*removed = old.values.Length()
+		return old, false
+	}
+}
+
+// entry is a key with the set of its values. values is nil on search
+// keys.
+type entry[K, V any] struct {
+	key    K
+	values *btree.BTree[V]
+}
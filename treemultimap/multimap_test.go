@@ -0,0 +1,57 @@
+package treemultimap_test
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree/treemultimap"
+)
+
+func TestPutRemove(t *testing.T) {
+	m1 := treemultimap.Empty(cmp.Compare[string], cmp.Compare[int]).
+		Put("bob", 3).
+		Put("alice", 2).
+		Put("bob", 1).
+		Put("bob", 3)
+	if m1.Len() != 3 || m1.KeyLen() != 2 {
+		t.Fatalf("m1: got len %v keys %v", m1.Len(), m1.KeyLen())
+	}
+	if got := slices.Collect(m1.Values("bob")); !slices.Equal(got, []int{1, 3}) {
+		t.Fatalf("m1.Values(bob) got %v", got)
+	}
+	if got := slices.Collect(m1.Keys()); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Fatalf("m1.Keys() got %v", got)
+	}
+	if m1.Put("bob", 1) != m1 || m1.Remove("bob", 7) != m1 {
+		t.Fatal("expected existing pair and missing pair to leave m1 unchanged")
+	}
+	var pairs []string
+	for k, v := range m1.From("b") {
+		pairs = append(pairs, fmt.Sprint(k, v))
+	}
+	if !slices.Equal(pairs, []string{"bob1", "bob3"}) {
+		t.Fatalf("m1.From(b) got %v", pairs)
+	}
+
+	m2 := m1.Remove("alice", 2).Remove("bob", 7)
+	if m2.Len() != 2 || m2.KeyLen() != 1 || m2.ContainsKey("alice") {
+		t.Fatalf("m2: got len %v keys %v", m2.Len(), m2.KeyLen())
+	}
+
+	m3 := m1.RemoveAll("bob")
+	if m3.Len() != 1 || m3.KeyLen() != 1 || m3.ContainsKey("bob") {
+		t.Fatalf("m3: got len %v keys %v", m3.Len(), m3.KeyLen())
+	}
+
+	tm := m1.AsTransient()
+	for i := 0; i < 1000; i++ {
+		tm.Put("carol", i)
+	}
+	tm.RemoveAll("alice")
+	m4 := tm.AsPersistent()
+	if m4.Len() != 1002 || m4.KeyLen() != 2 || m1.Len() != 3 {
+		t.Fatalf("m4: got len %v keys %v", m4.Len(), m4.KeyLen())
+	}
+}
@@ -0,0 +1,185 @@
+// Package treepq implements a persistent double-ended priority
+// queue. Both the minimum and the maximum are found by following a
+// single spine of the underlying B+Tree.
+package treepq
+
+import (
+	"iter"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Queue is a persistent priority queue. Values pushed with equal
+// priorities are kept in push order, so PopMin returns the oldest
+// and PopMax the newest of them.
+type Queue[P, V any] struct {
+	impl *btree.BTree[item[P, V]]
+	seq  uint64
+}
+
+func Empty[P, V any](cmp func(a, b P) int) *Queue[P, V] {
+	return &Queue[P, V]{
+		impl: btree.Empty[item[P, V]](
+			func(a, b item[P, V]) int {
+				if c := cmp(a.prio, b.prio); c != 0 {
+					return c
+				}
+				switch {
+				case a.seq < b.seq:
+					return -1
+				case a.seq > b.seq:
+					return 1
+				default:
+					return 0
+				}
+			},
+			func(a, b item[P, V]) bool {
+				return a.seq == b.seq
+			},
+		),
+	}
+}
+
+func (q *Queue[P, V]) Push(prio P, value V) *Queue[P, V] {
+	return &Queue[P, V]{
+		impl: q.impl.Add(item[P, V]{prio: prio, seq: q.seq, value: value}),
+		seq:  q.seq + 1,
+	}
+}
+
+// PeekMin returns the value with the smallest priority. The boolean
+// is false if the queue is empty.
+func (q *Queue[P, V]) PeekMin() (P, V, bool) {
+	it, ok := q.impl.Min()
+	return it.prio, it.value, ok
+}
+
+// PeekMax returns the value with the largest priority. The boolean
+// is false if the queue is empty.
+func (q *Queue[P, V]) PeekMax() (P, V, bool) {
+	it, ok := q.impl.Max()
+	return it.prio, it.value, ok
+}
+
+// PopMin returns the value with the smallest priority and a queue
+// without it. If the queue is empty the zero values and q itself are
+// returned.
+func (q *Queue[P, V]) PopMin() (P, V, *Queue[P, V]) {
+	it, rest, ok := q.impl.PopMin()
+	return q.pop(it, rest, ok)
+}
+
+// PopMax returns the value with the largest priority and a queue
+// without it. If the queue is empty the zero values and q itself are
+// returned.
+func (q *Queue[P, V]) PopMax() (P, V, *Queue[P, V]) {
+	it, rest, ok := q.impl.PopMax()
+	return q.pop(it, rest, ok)
+}
+
+func (q *Queue[P, V]) pop(
+	it item[P, V],
+	rest *btree.BTree[item[P, V]],
+	ok bool,
+) (P, V, *Queue[P, V]) {
+	if !ok {
+		return it.prio, it.value, q
+	}
+	return it.prio, it.value, &Queue[P, V]{
+		impl: rest,
+		seq:  q.seq,
+	}
+}
+
+func (q *Queue[P, V]) Len() int {
+	return q.impl.Length()
+}
+
+// All allows one to range over the queue from the smallest to the
+// largest priority without removing anything.
+func (q *Queue[P, V]) All() iter.Seq2[P, V] {
+	return all(q.impl.Iterator())
+}
+
+func (q *Queue[P, V]) AsTransient() *TQueue[P, V] {
+	return &TQueue[P, V]{
+		orig: q,
+		impl: q.impl.AsTransient(),
+		seq:  q.seq,
+	}
+}
+
+// TQueue is the transient counterpart of Queue, useful for pushing
+// or draining many values at once.
+type TQueue[P, V any] struct {
+	orig *Queue[P, V]
+	impl *btree.TBTree[item[P, V]]
+	seq  uint64
+}
+
+func (q *TQueue[P, V]) Push(prio P, value V) *TQueue[P, V] {
+	q.impl.Add(item[P, V]{prio: prio, seq: q.seq, value: value})
+	q.seq++
+	return q
+}
+
+func (q *TQueue[P, V]) PeekMin() (P, V, bool) {
+	it, ok := q.impl.Min()
+	return it.prio, it.value, ok
+}
+
+func (q *TQueue[P, V]) PeekMax() (P, V, bool) {
+	it, ok := q.impl.Max()
+	return it.prio, it.value, ok
+}
+
+// PopMin removes and returns the value with the smallest priority.
+// The boolean is false if the queue is empty.
+func (q *TQueue[P, V]) PopMin() (P, V, bool) {
+	it, ok := q.impl.PopMin()
+	return it.prio, it.value, ok
+}
+
+// PopMax removes and returns the value with the largest priority.
+// The boolean is false if the queue is empty.
+func (q *TQueue[P, V]) PopMax() (P, V, bool) {
+	it, ok := q.impl.PopMax()
+	return it.prio, it.value, ok
+}
+
+func (q *TQueue[P, V]) Len() int {
+	return q.impl.Length()
+}
+
+func (q *TQueue[P, V]) All() iter.Seq2[P, V] {
+	return all(q.impl.Iterator())
+}
+
+func (q *TQueue[P, V]) AsPersistent() *Queue[P, V] {
+	nimpl := q.impl.AsPersistent()
+	if nimpl == q.orig.impl {
+		return q.orig
+	}
+	return &Queue[P, V]{
+		impl: nimpl,
+		seq:  q.seq,
+	}
+}
+
+func all[P, V any](i btree.Iterator[item[P, V]]) iter.Seq2[P, V] {
+	return func(yield func(P, V) bool) {
+		for i.HasNext() {
+			it := i.Next()
+			if !yield(it.prio, it.value) {
+				return
+			}
+		}
+	}
+}
+
+// item is a queued value. seq breaks ties between equal priorities.
+type item[P, V any] struct {
+	prio  P
+	seq   uint64
+	value V
+}
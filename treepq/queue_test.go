@@ -0,0 +1,52 @@
+package treepq_test
+
+import (
+	"cmp"
+	"testing"
+
+	"jsouthworth.net/go/btree/treepq"
+)
+
+func TestPopOrder(t *testing.T) {
+	q := treepq.Empty[int, string](cmp.Compare[int]).
+		Push(2, "b").
+		Push(1, "a1").
+		Push(3, "c").
+		Push(1, "a2")
+
+	p, v, rest := q.PopMin()
+	if p != 1 || v != "a1" || rest.Len() != 3 || q.Len() != 4 {
+		t.Fatalf("PopMin got %v %v len %v", p, v, rest.Len())
+	}
+	p, v, rest = rest.PopMax()
+	if p != 3 || v != "c" || rest.Len() != 2 {
+		t.Fatalf("PopMax got %v %v len %v", p, v, rest.Len())
+	}
+	p, v, _ = rest.PopMin()
+	if p != 1 || v != "a2" {
+		t.Fatalf("PopMin got %v %v", p, v)
+	}
+
+	empty := treepq.Empty[int, string](cmp.Compare[int])
+	if _, _, got := empty.PopMin(); got != empty {
+		t.Fatal("PopMin on an empty queue returned a new queue")
+	}
+}
+
+func TestTransientDrain(t *testing.T) {
+	tq := treepq.Empty[int, int](cmp.Compare[int]).AsTransient()
+	for i := 0; i < 10000; i++ {
+		tq.Push((i*7919)%1000, i)
+	}
+	prev := -1
+	for tq.Len() > 0 {
+		p, _, ok := tq.PopMin()
+		if !ok || p < prev {
+			t.Fatalf("PopMin got %v after %v", p, prev)
+		}
+		prev = p
+	}
+	if _, _, ok := tq.PopMax(); ok {
+		t.Fatal("PopMax on a drained queue succeeded")
+	}
+}
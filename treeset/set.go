@@ -45,6 +45,54 @@ func (s *Set[T]) Remove(elem T) *Set[T] {
 	}
 }
 
+// Equal reports whether s and other contain the same elements.
+func (s *Set[T]) Equal(other *Set[T]) bool {
+	return btree.Equal(s.impl, other.impl)
+}
+
+// Compare compares s and other lexicographically. The result is 0 if
+// s == other, -1 if s < other, and +1 if s > other.
+func (s *Set[T]) Compare(other *Set[T]) int {
+	return btree.Compare(s.impl, other.impl, s.impl.Comparator())
+}
+
+// Find returns the element of the set equal to elem. The boolean is
+// false if there is none.
+func (s *Set[T]) Find(elem T) (T, bool) {
+	return s.impl.Find(elem)
+}
+
+// Floor returns the largest element less than or equal to elem. The
+// boolean is false if there is no such element.
+func (s *Set[T]) Floor(elem T) (T, bool) {
+	return s.impl.Floor(elem)
+}
+
+// Lower returns the largest element strictly less than elem. The
+// boolean is false if there is no such element.
+func (s *Set[T]) Lower(elem T) (T, bool) {
+	return s.impl.Lower(elem)
+}
+
+// Comparator returns the function ordering the elements of the set.
+func (s *Set[T]) Comparator() func(a, b T) int {
+	return s.impl.Comparator()
+}
+
+// WithObserver returns a set holding the same elements as s that
+// reports the work done by its edits to obs. See
+// btree.BTree.WithObserver.
+func (s *Set[T]) WithObserver(obs btree.Observer) *Set[T] {
+	return &Set[T]{impl: s.impl.WithObserver(obs)}
+}
+
+// WithBloom returns a set holding the same elements as s that checks
+// a bloom filter, hashing elements with hash, before searching for an
+// element. See btree.BTree.WithBloom.
+func (s *Set[T]) WithBloom(hash func(elem T) uint64, fpRate float64) *Set[T] {
+	return &Set[T]{impl: s.impl.WithBloom(hash, fpRate)}
+}
+
 func (s *Set[T]) Len() int {
 	return s.impl.Length()
 }
@@ -71,6 +119,19 @@ func (s *Set[T]) IteratorFrom(elem T) Iterator[T] {
 	}
 }
 
+func (s *Set[T]) Partitions(n int) []Range[T] {
+	parts := s.impl.Partitions(n)
+	out := make([]Range[T], len(parts))
+	for i, part := range parts {
+		out[i] = Range[T]{impl: part}
+	}
+	return out
+}
+
+func (s *Set[T]) ParallelForEach(n int, fn func(elem T)) {
+	s.impl.ParallelForEach(n, fn)
+}
+
 func (s *Set[T]) AsTransient() *TSet[T] {
 	return &TSet[T]{
 		orig: s,
@@ -97,6 +158,18 @@ func (s *TSet[T]) Remove(elem T) *TSet[T] {
 	return s
 }
 
+// TryAdd is like Add but returns an error instead of panicking if
+// the transient has already been made persistent.
+func (s *TSet[T]) TryAdd(elem T) error {
+	return s.impl.TryAdd(elem)
+}
+
+// TryRemove is like Remove but returns an error instead of panicking
+// if the transient has already been made persistent.
+func (s *TSet[T]) TryRemove(elem T) error {
+	return s.impl.TryDelete(elem)
+}
+
 func (s *TSet[T]) Len() int {
 	return s.impl.Length()
 }
@@ -133,6 +206,61 @@ func (s *TSet[T]) AsPersistent() *Set[T] {
 	}
 }
 
+// TryAsPersistent is like AsPersistent but returns an error instead
+// of panicking if the transient has already been made persistent.
+func (s *TSet[T]) TryAsPersistent() (*Set[T], error) {
+	nimpl, err := s.impl.TryAsPersistent()
+	if err != nil {
+		return nil, err
+	}
+	if nimpl == s.orig.impl {
+		return s.orig, nil
+	}
+	return &Set[T]{
+		impl: nimpl,
+	}, nil
+}
+
+// Rollback discards every change made through the transient and
+// returns the set it was made from. See (*btree.TBTree[T]).Rollback.
+func (s *TSet[T]) Rollback() *Set[T] {
+	s.impl.Rollback()
+	return s.orig
+}
+
+// Savepoint is a state of a TSet that it may be rolled back to.
+type Savepoint[T any] struct {
+	impl *btree.Savepoint[T]
+}
+
+// Savepoint records the current state of the transient. See
+// (*btree.TBTree[T]).Savepoint.
+func (s *TSet[T]) Savepoint() Savepoint[T] {
+	return Savepoint[T]{impl: s.impl.Savepoint()}
+}
+
+// RollbackTo discards the changes made since sp was recorded. See
+// (*btree.TBTree[T]).RollbackTo.
+func (s *TSet[T]) RollbackTo(sp Savepoint[T]) *TSet[T] {
+	s.impl.RollbackTo(sp.impl)
+	return s
+}
+
+type Range[T any] struct {
+	impl btree.Range[T]
+}
+
+func (r Range[T]) All() iter.Seq[T] {
+	i := r.Iterator()
+	return i.Seq
+}
+
+func (r Range[T]) Iterator() Iterator[T] {
+	return Iterator[T]{
+		impl: r.impl.Iterator(),
+	}
+}
+
 type Iterator[T any] struct{
 	impl btree.Iterator[T]
 }
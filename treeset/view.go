@@ -0,0 +1,154 @@
+package treeset
+
+import (
+	"iter"
+)
+
+// View is a read-only view of the elements of a Set that lie in a
+// range. Views are created with SubSet, HeadSet and TailSet and share
+// the nodes of the set; nothing is copied. Lower bounds are inclusive
+// and upper bounds are exclusive.
+type View[T any] struct {
+	s      *Set[T]
+	cmp    func(a, b T) int
+	lo, hi bound[T]
+}
+
+// bound is one end of a View's range. ok is false if the range is
+// unbounded at that end.
+type bound[T any] struct {
+	elem T
+	ok   bool
+}
+
+// SubSet returns a view of the elements that are at least lo and
+// below hi.
+func (s *Set[T]) SubSet(lo, hi T) View[T] {
+	return s.view().SubSet(lo, hi)
+}
+
+// HeadSet returns a view of the elements that are below hi.
+func (s *Set[T]) HeadSet(hi T) View[T] {
+	return s.view().HeadSet(hi)
+}
+
+// TailSet returns a view of the elements that are at least lo.
+func (s *Set[T]) TailSet(lo T) View[T] {
+	return s.view().TailSet(lo)
+}
+
+func (s *Set[T]) view() View[T] {
+	return View[T]{s: s, cmp: s.Comparator()}
+}
+
+// SubSet narrows the view to the elements that are also at least lo
+// and below hi.
+func (v View[T]) SubSet(lo, hi T) View[T] {
+	return v.TailSet(lo).HeadSet(hi)
+}
+
+// HeadSet narrows the view to the elements that are also below hi.
+func (v View[T]) HeadSet(hi T) View[T] {
+	if !v.hi.ok || v.cmp(hi, v.hi.elem) < 0 {
+		v.hi = bound[T]{elem: hi, ok: true}
+	}
+	return v
+}
+
+// TailSet narrows the view to the elements that are also at least
+// lo.
+func (v View[T]) TailSet(lo T) View[T] {
+	if !v.lo.ok || v.cmp(lo, v.lo.elem) > 0 {
+		v.lo = bound[T]{elem: lo, ok: true}
+	}
+	return v
+}
+
+func (v View[T]) Contains(elem T) bool {
+	return v.inRange(elem) && v.s.Contains(elem)
+}
+
+// Find returns the element of the view equal to elem. The boolean is
+// false if there is none.
+func (v View[T]) Find(elem T) (T, bool) {
+	if !v.inRange(elem) {
+		return v.none()
+	}
+	return v.s.Find(elem)
+}
+
+// Len returns the number of elements in the view. This is O(1) for an
+// unbounded view and otherwise counts the elements in range.
+func (v View[T]) Len() int {
+	if !v.lo.ok && !v.hi.ok {
+		return v.s.Len()
+	}
+	var n int
+	for range v.All() {
+		n++
+	}
+	return n
+}
+
+// Min returns the smallest element of the view. The boolean is false
+// if the view is empty.
+func (v View[T]) Min() (T, bool) {
+	i := v.s.Iterator()
+	if v.lo.ok {
+		i = v.s.IteratorFrom(v.lo.elem)
+	}
+	if !i.HasNext() {
+		return v.none()
+	}
+	elem := i.Next()
+	if !v.belowHi(elem) {
+		return v.none()
+	}
+	return elem, true
+}
+
+// Max returns the largest element of the view. The boolean is false
+// if the view is empty.
+func (v View[T]) Max() (T, bool) {
+	elem, ok := v.s.impl.Max()
+	if v.hi.ok {
+		elem, ok = v.s.impl.Lower(v.hi.elem)
+	}
+	if !ok || !v.aboveLo(elem) {
+		return v.none()
+	}
+	return elem, true
+}
+
+// All allows one to range over the elements of the view in order.
+func (v View[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		i := v.s.Iterator()
+		if v.lo.ok {
+			i = v.s.IteratorFrom(v.lo.elem)
+		}
+		for i.HasNext() {
+			elem := i.Next()
+			if !v.belowHi(elem) || !yield(elem) {
+				return
+			}
+		}
+	}
+}
+
+func (v View[T]) inRange(elem T) bool {
+	return v.aboveLo(elem) && v.belowHi(elem)
+}
+
+func (v View[T]) aboveLo(elem T) bool {
+	return !v.lo.ok || v.cmp(elem, v.lo.elem) >= 0
+}
+
+func (v View[T]) belowHi(elem T) bool {
+	return !v.hi.ok || v.cmp(elem, v.hi.elem) < 0
+}
+
+func (v View[T]) none() (T, bool) {
+	var zero T
+	return zero, false
+}
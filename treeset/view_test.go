@@ -0,0 +1,81 @@
+package treeset_test
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	"jsouthworth.net/go/btree/treeset"
+)
+
+func TestView(t *testing.T) {
+	ts := treeset.Empty(cmp.Compare[int]).AsTransient()
+	for elem := 0; elem < 1000; elem += 2 {
+		ts.Add(elem)
+	}
+	s := ts.AsPersistent()
+
+	v := s.SubSet(100, 200)
+	if v.Len() != 50 || v.Contains(200) || !v.Contains(100) ||
+		v.Contains(98) || s.TailSet(0).Len() != 500 {
+		t.Fatalf("got len %v", v.Len())
+	}
+	if elem, ok := v.Find(150); !ok || elem != 150 {
+		t.Fatalf("Find(150): got %v %v", elem, ok)
+	}
+	if _, ok := v.Find(300); ok {
+		t.Fatal("Find(300) found an element outside the view")
+	}
+	if _, ok := v.Find(151); ok {
+		t.Fatal("Find(151) found a missing element")
+	}
+	if elem, ok := v.Min(); !ok || elem != 100 {
+		t.Fatalf("Min: got %v %v", elem, ok)
+	}
+	if elem, ok := v.Max(); !ok || elem != 198 {
+		t.Fatalf("Max: got %v %v", elem, ok)
+	}
+
+	// Narrowing intersects with the existing range.
+	n := v.HeadSet(151).TailSet(50).SubSet(120, 500)
+	elems := slices.Collect(n.All())
+	if len(elems) != 16 || elems[0] != 120 || elems[15] != 150 {
+		t.Fatalf("narrowed elements: got %v", elems)
+	}
+
+	empty := s.SubSet(101, 102)
+	if _, ok := empty.Min(); ok {
+		t.Fatal("Min of empty view succeeded")
+	}
+	if _, ok := empty.Max(); ok {
+		t.Fatal("Max of empty view succeeded")
+	}
+	if elem, ok := s.HeadSet(1000000).Max(); !ok || elem != 998 {
+		t.Fatalf("Max of head view: got %v %v", elem, ok)
+	}
+	if _, ok := s.HeadSet(0).Max(); ok {
+		t.Fatal("Max of view below every element succeeded")
+	}
+}
+
+func TestFloorLower(t *testing.T) {
+	s := treeset.Empty(cmp.Compare[int]).Add(10).Add(20).Add(30)
+	for _, tc := range []struct {
+		elem         int
+		floor, lower int
+		fok, lok     bool
+	}{
+		{5, 0, 0, false, false},
+		{10, 10, 0, true, false},
+		{15, 10, 10, true, true},
+		{20, 20, 10, true, true},
+		{35, 30, 30, true, true},
+	} {
+		if got, ok := s.Floor(tc.elem); got != tc.floor || ok != tc.fok {
+			t.Errorf("Floor(%v): got %v %v", tc.elem, got, ok)
+		}
+		if got, ok := s.Lower(tc.elem); got != tc.lower || ok != tc.lok {
+			t.Errorf("Lower(%v): got %v %v", tc.elem, got, ok)
+		}
+	}
+}
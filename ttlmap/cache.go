@@ -0,0 +1,145 @@
+package ttlmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of time for a Cache. Tests may supply a clock
+// they advance by hand.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock returns a Clock reading the system time.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Options configures a Cache. The zero value uses the system clock
+// and does not sweep in the background.
+type Options struct {
+	// Clock is the source of time, by default the system clock.
+	Clock Clock
+	// SweepInterval is the time between background sweeps. If it
+	// is zero the cache is only swept by calls to Sweep.
+	SweepInterval time.Duration
+}
+
+// Cache holds a Map that may be used from several goroutines at once.
+// Readers never block; writers are serialized. Each entry is given a
+// time to live measured by the cache's clock, and a background
+// goroutine may sweep out expired entries periodically.
+type Cache[K, V any] struct {
+	cur   atomic.Pointer[Map[K, V]]
+	mu    sync.Mutex
+	clock Clock
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewCache returns a cache holding m. If opts asks for background
+// sweeping the cache must be closed to stop it.
+func NewCache[K, V any](m *Map[K, V], opts *Options) *Cache[K, V] {
+	if opts == nil {
+		opts = &Options{}
+	}
+	c := &Cache[K, V]{
+		clock: opts.Clock,
+		done:  make(chan struct{}),
+	}
+	if c.clock == nil {
+		c.clock = SystemClock()
+	}
+	c.cur.Store(m)
+	if opts.SweepInterval > 0 {
+		c.wg.Add(1)
+		go c.sweeper(opts.SweepInterval)
+	}
+	return c
+}
+
+// Get returns the value of key if it has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	return c.cur.Load().Find(key, c.clock.Now())
+}
+
+// Set stores value for key for the duration ttl. An entry with a ttl
+// of zero or less never expires.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.clock.Now().Add(ttl)
+	}
+	c.update(func(m *Map[K, V]) *Map[K, V] {
+		return m.Assoc(key, value, expires)
+	})
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.update(func(m *Map[K, V]) *Map[K, V] {
+		return m.Delete(key)
+	})
+}
+
+// Snapshot returns the current contents of the cache. It may hold
+// expired entries that have not yet been swept; these are hidden by
+// lookups made at the current time.
+func (c *Cache[K, V]) Snapshot() *Map[K, V] {
+	return c.cur.Load()
+}
+
+// Sweep removes the entries that have expired and returns how many
+// there were.
+func (c *Cache[K, V]) Sweep() int {
+	var n int
+	c.update(func(m *Map[K, V]) *Map[K, V] {
+		swept := m.Sweep(c.clock.Now())
+		n = m.Len() - swept.Len()
+		return swept
+	})
+	return n
+}
+
+// Close stops the background sweeper, waiting for a sweep in progress
+// to finish. It is safe to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+}
+
+func (c *Cache[K, V]) update(fn func(m *Map[K, V]) *Map[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur.Store(fn(c.cur.Load()))
+}
+
+func (c *Cache[K, V]) sweeper(interval time.Duration) {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.clock.After(interval):
+			c.Sweep()
+		case <-c.done:
+			return
+		}
+	}
+}
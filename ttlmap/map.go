@@ -0,0 +1,173 @@
+// Package ttlmap implements maps whose entries expire. Alongside the
+// entries ordered by key each map keeps an index of them ordered by
+// expiration time, so sweeping out the expired entries costs
+// O(expired log n) however large the map is. Between sweeps expired
+// entries are hidden from lookups made at a later time.
+package ttlmap
+
+import (
+	"iter"
+	"time"
+
+	"jsouthworth.net/go/btree"
+)
+
+// Map is a persistent map whose entries expire. An entry is expired
+// at or after its expiration time; an entry stored with the zero time
+// never expires.
+type Map[K, V any] struct {
+	byKey  *btree.BTree[entry[K, V]]
+	byTime *btree.BTree[entry[K, V]]
+}
+
+func Empty[K, V any](cmp func(a, b K) int, eq func(a, b V) bool) *Map[K, V] {
+	return &Map[K, V]{
+		byKey: btree.Empty(
+			func(a, b entry[K, V]) int {
+				return cmp(a.key, b.key)
+			},
+			func(a, b entry[K, V]) bool {
+				return cmp(a.key, b.key) == 0 &&
+					a.expires.Equal(b.expires) &&
+					eq(a.value, b.value)
+			},
+		),
+		byTime: btree.Empty(
+			func(a, b entry[K, V]) int {
+				if c := a.expires.Compare(b.expires); c != 0 {
+					return c
+				}
+				return cmp(a.key, b.key)
+			},
+			func(a, b entry[K, V]) bool {
+				return a.expires.Equal(b.expires) &&
+					cmp(a.key, b.key) == 0
+			},
+		),
+	}
+}
+
+// Find returns the value of key as of now. The boolean is false if
+// there is none or it has expired.
+func (m *Map[K, V]) Find(key K, now time.Time) (V, bool) {
+	e, ok := m.byKey.Find(entry[K, V]{key: key})
+	if !ok || e.expiredAt(now) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (m *Map[K, V]) Contains(key K, now time.Time) bool {
+	_, ok := m.Find(key, now)
+	return ok
+}
+
+// Expires returns the expiration time of key, which is the zero time
+// if it never expires. The boolean is false if there is no entry for
+// key, expired or not.
+func (m *Map[K, V]) Expires(key K) (time.Time, bool) {
+	e, ok := m.byKey.Find(entry[K, V]{key: key})
+	return e.expires, ok
+}
+
+// Assoc returns a map in which key holds value until expires,
+// replacing any previous entry for key.
+func (m *Map[K, V]) Assoc(key K, value V, expires time.Time) *Map[K, V] {
+	e := entry[K, V]{key: key, value: value, expires: expires}
+	byKey := m.byKey.Add(e)
+	if byKey == m.byKey {
+		return m
+	}
+	byTime := m.byTime
+	if old, ok := m.byKey.Find(e); ok && !old.expires.IsZero() {
+		byTime = byTime.Delete(old)
+	}
+	if !expires.IsZero() {
+		byTime = byTime.Add(e)
+	}
+	return &Map[K, V]{byKey: byKey, byTime: byTime}
+}
+
+func (m *Map[K, V]) Delete(key K) *Map[K, V] {
+	old, ok := m.byKey.Find(entry[K, V]{key: key})
+	if !ok {
+		return m
+	}
+	byTime := m.byTime
+	if !old.expires.IsZero() {
+		byTime = byTime.Delete(old)
+	}
+	return &Map[K, V]{byKey: m.byKey.Delete(old), byTime: byTime}
+}
+
+// Len returns the number of entries in the map, counting expired
+// entries that have not been swept.
+func (m *Map[K, V]) Len() int {
+	return m.byKey.Length()
+}
+
+// All iterates over the entries that have not expired as of now in
+// key order.
+func (m *Map[K, V]) All(now time.Time) iter.Seq2[K, V] {
+	return func(yield func(key K, value V) bool) {
+		for e := range m.byKey.All() {
+			if e.expiredAt(now) {
+				continue
+			}
+			if !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Expired iterates over the entries that have expired as of now in
+// order of expiration. These are the entries Sweep(now) removes.
+func (m *Map[K, V]) Expired(now time.Time) iter.Seq2[K, V] {
+	return func(yield func(key K, value V) bool) {
+		for e := range m.byTime.All() {
+			if !e.expiredAt(now) || !yield(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// NextExpiry returns the earliest expiration time of any entry. The
+// boolean is false if no entry expires.
+func (m *Map[K, V]) NextExpiry() (time.Time, bool) {
+	e, ok := m.byTime.Min()
+	return e.expires, ok
+}
+
+// Sweep returns a map without the entries that have expired as of
+// now. Only the expired entries are visited.
+func (m *Map[K, V]) Sweep(now time.Time) *Map[K, V] {
+	if first, ok := m.byTime.Min(); !ok || !first.expiredAt(now) {
+		return m
+	}
+	byKey := m.byKey.AsTransient()
+	byTime := m.byTime.AsTransient()
+	for e := range m.byTime.All() {
+		if !e.expiredAt(now) {
+			break
+		}
+		byKey.Delete(e)
+		byTime.Delete(e)
+	}
+	return &Map[K, V]{
+		byKey:  byKey.AsPersistent(),
+		byTime: byTime.AsPersistent(),
+	}
+}
+
+type entry[K, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func (e entry[K, V]) expiredAt(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
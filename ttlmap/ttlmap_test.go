@@ -0,0 +1,224 @@
+package ttlmap_test
+
+import (
+	"cmp"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leanovate/gopter"
+	"github.com/leanovate/gopter/gen"
+	"github.com/leanovate/gopter/prop"
+	"jsouthworth.net/go/btree/ttlmap"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func intEq(a, b int) bool {
+	return a == b
+}
+
+// op is a generated update made one second after the previous one.
+// Kind 0 stores Key for TTL seconds, or forever if TTL is zero, kind 1
+// deletes it and kind 2 sweeps the map.
+type op struct {
+	Kind int
+	Key  int
+	TTL  int
+}
+
+type modelEntry struct {
+	value   int
+	expires time.Time
+}
+
+func TestMap(t *testing.T) {
+	parameters := gopter.DefaultTestParameters()
+	properties := gopter.NewProperties(parameters)
+	properties.Property("map agrees with a model",
+		prop.ForAll(
+			func(ops []op) bool {
+				m := ttlmap.Empty[int, int](cmp.Compare[int], intEq)
+				model := map[int]modelEntry{}
+				now := epoch
+				for n, o := range ops {
+					now = now.Add(time.Second)
+					switch o.Kind {
+					case 0:
+						var expires time.Time
+						if o.TTL > 0 {
+							expires = now.Add(time.Duration(o.TTL) * time.Second)
+						}
+						m = m.Assoc(o.Key, n, expires)
+						model[o.Key] = modelEntry{n, expires}
+					case 1:
+						m = m.Delete(o.Key)
+						delete(model, o.Key)
+					case 2:
+						var expired int
+						for range m.Expired(now) {
+							expired++
+						}
+						swept := m.Sweep(now)
+						if swept.Len() != m.Len()-expired {
+							return false
+						}
+						m = swept
+						for k, e := range model {
+							if !e.expires.IsZero() && !now.Before(e.expires) {
+								delete(model, k)
+							}
+						}
+						if m.Len() != len(model) {
+							return false
+						}
+					}
+					for k := 0; k < 20; k++ {
+						v, ok := m.Find(k, now)
+						e, live := model[k]
+						live = live && (e.expires.IsZero() || now.Before(e.expires))
+						if ok != live || ok && v != e.value {
+							return false
+						}
+					}
+				}
+				var live int
+				for k, v := range m.All(now) {
+					if e := model[k]; e.value != v {
+						return false
+					}
+					live++
+				}
+				return live+countSeq(m.Expired(now)) == m.Len()
+			},
+			gen.SliceOf(gen.Struct(reflect.TypeOf(op{}), map[string]gopter.Gen{
+				"Kind": gen.IntRange(0, 2),
+				"Key":  gen.IntRange(0, 20),
+				"TTL":  gen.IntRange(0, 5),
+			})),
+		))
+	properties.TestingRun(t)
+}
+
+func countSeq[K, V any](seq func(yield func(K, V) bool)) int {
+	var n int
+	for range seq {
+		n++
+	}
+	return n
+}
+
+func TestNextExpiry(t *testing.T) {
+	m := ttlmap.Empty[int, int](cmp.Compare[int], intEq)
+	if _, ok := m.NextExpiry(); ok {
+		t.Fatal("empty map has an expiry")
+	}
+	m = m.Assoc(1, 1, time.Time{}).
+		Assoc(2, 2, epoch.Add(2*time.Second)).
+		Assoc(3, 3, epoch.Add(time.Second))
+	if next, _ := m.NextExpiry(); !next.Equal(epoch.Add(time.Second)) {
+		t.Fatalf("got next expiry %v", next)
+	}
+	m = m.Assoc(3, 3, epoch.Add(3*time.Second))
+	if next, _ := m.NextExpiry(); !next.Equal(epoch.Add(2 * time.Second)) {
+		t.Fatalf("got next expiry %v after extending 3", next)
+	}
+	m = m.Sweep(epoch.Add(time.Hour))
+	if _, ok := m.NextExpiry(); ok || m.Len() != 1 || !m.Contains(1, epoch) {
+		t.Fatalf("got %v entries after sweeping", m.Len())
+	}
+}
+
+// fakeClock is advanced by hand. Each call to After is signalled on
+// asleep so tests can wait for the sweeper to finish a sweep.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	asleep  chan struct{}
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: epoch, asleep: make(chan struct{}, 1)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	select {
+	case c.asleep <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var pending []waiter
+	for _, w := range c.waiters {
+		if c.now.Before(w.at) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+func TestCacheSweeper(t *testing.T) {
+	clock := newFakeClock()
+	c := ttlmap.NewCache(
+		ttlmap.Empty[int, int](cmp.Compare[int], intEq),
+		&ttlmap.Options{Clock: clock, SweepInterval: time.Minute},
+	)
+	defer c.Close()
+	<-clock.asleep
+
+	c.Set(1, 1, 30*time.Second)
+	c.Set(2, 2, 90*time.Second)
+	c.Set(3, 3, 0)
+	clock.Advance(45 * time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Fatal("got expired entry 1")
+	}
+	if c.Snapshot().Len() != 3 {
+		t.Fatal("entries swept before the sweep interval")
+	}
+
+	clock.Advance(15 * time.Second)
+	<-clock.asleep
+	if got := c.Snapshot().Len(); got != 2 {
+		t.Fatalf("got %v entries after first sweep expected 2", got)
+	}
+	clock.Advance(time.Minute)
+	<-clock.asleep
+	snap := c.Snapshot()
+	if v, ok := c.Get(3); snap.Len() != 1 || !ok || v != 3 {
+		t.Fatalf("got %v entries after second sweep expected only 3", snap.Len())
+	}
+
+	c.Delete(3)
+	if _, ok := c.Get(3); ok || c.Sweep() != 0 {
+		t.Fatal("deleted entry remains")
+	}
+	if !snap.Contains(3, clock.Now()) {
+		t.Fatal("snapshot changed by later writes")
+	}
+	c.Close()
+}